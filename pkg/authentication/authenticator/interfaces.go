@@ -0,0 +1,21 @@
+package authenticator
+
+import (
+	"github.com/ForbiddenR/apiserver/pkg/authentication/user"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Request attempts to extract authentication information from a request.
+// It returns false if the request carries no authentication information,
+// and an error if the information is present but invalid.
+type Request interface {
+	AuthenticateRequest(c *fiber.Ctx) (user.Info, bool, error)
+}
+
+// RequestFunc is a function that implements the Request interface.
+type RequestFunc func(c *fiber.Ctx) (user.Info, bool, error)
+
+// AuthenticateRequest implements authenticator.Request.
+func (f RequestFunc) AuthenticateRequest(c *fiber.Ctx) (user.Info, bool, error) {
+	return f(c)
+}
@@ -0,0 +1,102 @@
+package x509
+
+import (
+	"crypto/x509"
+	"fmt"
+
+	"github.com/ForbiddenR/apiserver/pkg/authentication/authenticator"
+	"github.com/ForbiddenR/apiserver/pkg/authentication/user"
+	"github.com/gofiber/fiber/v2"
+)
+
+// The keys of the extra user information taken from the client certificate.
+const (
+	ExtraOrganizationalUnits = "x509/organizational-units"
+	ExtraDNSNames            = "x509/dns-names"
+	ExtraEmailAddresses      = "x509/email-addresses"
+	ExtraIPAddresses         = "x509/ip-addresses"
+	ExtraURIs                = "x509/uris"
+)
+
+// UserConversion defines an interface for extracting user info from a client certificate chain
+type UserConversion interface {
+	User(chain []*x509.Certificate) (user.Info, bool, error)
+}
+
+// UserConversionFunc is a function that implements the UserConversion interface.
+type UserConversionFunc func(chain []*x509.Certificate) (user.Info, bool, error)
+
+// User implements x509.UserConversion
+func (f UserConversionFunc) User(chain []*x509.Certificate) (user.Info, bool, error) {
+	return f(chain)
+}
+
+var _ authenticator.Request = &Authenticator{}
+
+// Authenticator implements request.Authenticator by extracting user info from
+// the client certificate which was verified during the TLS handshake.
+type Authenticator struct {
+	user UserConversion
+}
+
+// New returns a request.Authenticator that extracts user info using the
+// provided UserConversion from the verified client certificate of a request.
+func New(user UserConversion) *Authenticator {
+	return &Authenticator{user: user}
+}
+
+// AuthenticateRequest authenticates the request using presented client certificates
+func (a *Authenticator) AuthenticateRequest(c *fiber.Ctx) (user.Info, bool, error) {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return nil, false, nil
+	}
+
+	var errlist []error
+	for _, chain := range state.VerifiedChains {
+		user, ok, err := a.user.User(chain)
+		if err != nil {
+			errlist = append(errlist, err)
+			continue
+		}
+		if ok {
+			return user, ok, err
+		}
+	}
+	if len(errlist) > 0 {
+		return nil, false, fmt.Errorf("unable to authenticate client certificate: %v", errlist)
+	}
+	return nil, false, nil
+}
+
+// CommonNameUserConversion builds user info from a certificate chain using the subject's CommonName
+// as name and its Organizations as groups. The OrganizationalUnits and the SANs are kept as extra.
+var CommonNameUserConversion = UserConversionFunc(func(chain []*x509.Certificate) (user.Info, bool, error) {
+	if len(chain[0].Subject.CommonName) == 0 {
+		return nil, false, nil
+	}
+
+	cert := chain[0]
+	extra := map[string][]string{}
+	if len(cert.Subject.OrganizationalUnit) > 0 {
+		extra[ExtraOrganizationalUnits] = cert.Subject.OrganizationalUnit
+	}
+	if len(cert.DNSNames) > 0 {
+		extra[ExtraDNSNames] = cert.DNSNames
+	}
+	if len(cert.EmailAddresses) > 0 {
+		extra[ExtraEmailAddresses] = cert.EmailAddresses
+	}
+	for _, ip := range cert.IPAddresses {
+		extra[ExtraIPAddresses] = append(extra[ExtraIPAddresses], ip.String())
+	}
+	for _, uri := range cert.URIs {
+		extra[ExtraURIs] = append(extra[ExtraURIs], uri.String())
+	}
+
+	return &user.DefaultInfo{
+		Name:   cert.Subject.CommonName,
+		Groups: cert.Subject.Organization,
+		Extra:  extra,
+	}, true, nil
+})
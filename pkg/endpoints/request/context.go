@@ -0,0 +1,25 @@
+package request
+
+import (
+	"github.com/ForbiddenR/apiserver/pkg/authentication/user"
+	"github.com/gofiber/fiber/v2"
+)
+
+// The key type is unexported to prevent collisions
+type key int
+
+const (
+	// userKey is the locals key for the user.Info of the request.
+	userKey key = iota
+)
+
+// WithUser stores the user of the request in the locals of c.
+func WithUser(c *fiber.Ctx, user user.Info) {
+	c.Locals(userKey, user)
+}
+
+// UserFrom returns the user of the request, if present.
+func UserFrom(c *fiber.Ctx) (user.Info, bool) {
+	user, ok := c.Locals(userKey).(user.Info)
+	return user, ok
+}
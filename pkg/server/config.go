@@ -1,10 +1,22 @@
 package server
 
 import (
+	"crypto/x509"
+	"fmt"
 	"net"
+	"os"
+	"sync/atomic"
 	"time"
 
+	"github.com/ForbiddenR/apiserver/pkg/authentication/authenticator"
+	x509request "github.com/ForbiddenR/apiserver/pkg/authentication/request/x509"
+	"github.com/ForbiddenR/apiserver/pkg/server/dynamiccertificates"
+	genericfilters "github.com/ForbiddenR/apiserver/pkg/server/filters"
 	"github.com/ForbiddenR/apiserver/pkg/server/healthz"
+	"github.com/ForbiddenR/apiserver/pkg/util/connlimit"
+	"github.com/ForbiddenR/apiserver/pkg/util/flowcontrol"
+	"github.com/ForbiddenR/apiserver/pkg/util/proxyproto"
+	"github.com/gofiber/fiber/v2"
 )
 
 type Config struct {
@@ -14,6 +26,48 @@ type Config struct {
 	LivezChecks []healthz.HealthzChecker
 	// The default set of readyz-only checks. There might be more added via AddReadyzChecks dynamically.
 	ReadyzChecks []healthz.HealthzChecker
+	// The default set of startup checks. There might be more added via AddStartupChecks dynamically.
+	// Once all of them succeeded, /startup stays green.
+	StartupChecks []healthz.HealthzChecker
+	// HealthCheckTimeout bounds the duration of every single health check. A check which
+	// doesn't finish in time is reported as failed. Zero means no timeout.
+	HealthCheckTimeout time.Duration
+	// HealthTimeout bounds the duration of all health checks of a probe. Zero means no timeout.
+	HealthTimeout time.Duration
+	// HealthShowDetails controls whether /actuator/health renders its components and their details.
+	HealthShowDetails healthz.ShowDetails
+	// HealthDetailsAuthorizer decides whether a request may see the details of /actuator/health
+	// when HealthShowDetails is "when-authorized".
+	HealthDetailsAuthorizer func(ctx *fiber.Ctx) bool
+	// Authentication authenticates the requests, the user is available to the handlers through
+	// request.UserFrom. If nil and Serving has a ClientCA, the common name of verified client
+	// certificates is used.
+	Authentication authenticator.Request
+	// BuildHandlerChainFunc allows you to build custom handler chains by installing middlewares on the app
+	// before any route is registered.
+	BuildHandlerChainFunc func(app *fiber.App, c *Config)
+	// LongRunningFunc is a predicate which is true for long-running http requests.
+	LongRunningFunc genericfilters.LongRunningRequestCheck
+	// MaxRequestsInFlight is the maximum number of parallel non-long-running read-only requests.
+	// Requests beyond it are rejected with 429. Zero means no limit.
+	MaxRequestsInFlight int
+	// MaxMutatingRequestsInFlight is the maximum number of parallel non-long-running mutating
+	// requests. Requests beyond it are rejected with 429. Zero means no limit.
+	MaxMutatingRequestsInFlight int
+	// RateLimits are token bucket rate limits per client identity and route. A request
+	// counts against every rule matching it and is rejected with 429 once one is exhausted.
+	RateLimits []genericfilters.RateLimitRule
+	// RateLimitStore keeps the token buckets of RateLimits. If nil, they are kept in memory.
+	RateLimitStore flowcontrol.RateLimitStore
+	// FlowControl, if set, admits the requests through priority-and-fairness queuing
+	// instead of MaxRequestsInFlight and MaxMutatingRequestsInFlight.
+	FlowControl *flowcontrol.Controller
+	// EnableFlowControlDebugging serves the state of FlowControl, including the names and
+	// addresses of its clients, on /debug/flowcontrol to the requests DebuggingAuthorizer allows.
+	EnableFlowControlDebugging bool
+	// DebuggingAuthorizer decides whether an authenticated request may access the debugging
+	// endpoints. If nil, only users of the "system:masters" group may.
+	DebuggingAuthorizer func(ctx *fiber.Ctx) bool
 	// If specified, all requests except those which match the LongRunningFunc predicate will timeout
 	// after this duration.
 	RequestTimeout time.Duration
@@ -24,6 +78,17 @@ type Config struct {
 	// During this time, the API server keeps serving, /healthz will return 200,
 	// but /readyz will return failure.
 	ShutdownDelayDuration time.Duration
+	// UpgradeSignal, if set, makes the server start a new process of its binary which takes over
+	// its listeners when the signal is received, e.g. syscall.SIGUSR2. Once the new process is
+	// ready, the server shuts down gracefully as if its stop channel was closed.
+	UpgradeSignal os.Signal
+	// UpgradeTimeout bounds how long the server waits for the new process of an upgrade
+	// to become ready. The upgrade is aborted if it doesn't.
+	UpgradeTimeout time.Duration
+
+	// maxInFlight is the in-flight budget of MaxRequestsInFlight and MaxMutatingRequestsInFlight
+	// built by Complete, nil if there is none.
+	maxInFlight *genericfilters.MaxInFlightLimit
 
 	// lifecycleSignals provides access to the various signals
 	// that happen during lifecycle of the apiserver.
@@ -34,6 +99,13 @@ type Config struct {
 // Complete fills in any fields not set that are required to have valid data and can be drived
 // from othe fields. If you're going to `ApplyOptions`, do that first. It's mutating the receiver.
 func (c *Config) Complete() CompletedConfig {
+	if c.Authentication == nil && c.Serving != nil && c.Serving.ClientCA != nil {
+		c.Authentication = x509request.New(x509request.CommonNameUserConversion)
+	}
+	if c.maxInFlight == nil && c.FlowControl == nil && (c.MaxRequestsInFlight > 0 || c.MaxMutatingRequestsInFlight > 0) {
+		c.maxInFlight = genericfilters.NewMaxInFlightLimit(c.MaxRequestsInFlight, c.MaxMutatingRequestsInFlight)
+	}
+
 	return CompletedConfig{&completedConfig{c}}
 }
 
@@ -44,6 +116,66 @@ type RecommendedConfig struct {
 type ServingInfo struct {
 	// Listener is the secure server network listener.
 	Listener net.Listener
+
+	// ListenerName is the name Listener is handed over with to a new process on upgrades,
+	// see ServingOptions.SocketActivationName.
+	ListenerName string
+
+	// Routes restricts the routes served on Listener to these path prefixes, e.g. "/api".
+	// All routes are served if empty.
+	Routes []string
+
+	// AdditionalListeners are served alongside Listener with the same handler, certificates
+	// and graceful shutdown, e.g. an admin port bound to localhost which only serves the health endpoints.
+	AdditionalListeners []NamedListener
+
+	// Cert is the main server cert. If nil, plain http is served on Listener.
+	// It is reloaded while serving if it is a dynamiccertificates.ControllerRunner.
+	Cert dynamiccertificates.CertProvider
+
+	// SNICerts are the certificates selected by the server name of the TLS handshake,
+	// Cert is served if none of them matches. They are reloaded like Cert.
+	SNICerts []dynamiccertificates.SNICertProvider
+
+	// MinTLSVersion optionally overrides the minimum TLS version supported.
+	// Values are from tls package constants (https://golang.org/pkg/crypto/tls/#pkg-constants).
+	MinTLSVersion uint16
+
+	// CipherSuites optionally overrides the list of allowed cipher suites for the server.
+	// Values are from tls package constants (https://golang.org/pkg/crypto/tls/#pkg-constants).
+	CipherSuites []uint16
+
+	// NextProtos is the list of application protocols advertised via ALPN.
+	NextProtos []string
+
+	// ClientCA is the certificate bundle for all the signers that you'll recognize for incoming client certificates.
+	// If set, client certificates are requested and verified against it.
+	ClientCA *x509.CertPool
+
+	// ClientCertRequired rejects the TLS handshake of clients which don't present a certificate signed by ClientCA.
+	ClientCertRequired bool
+
+	// KeepAlivePeriod is the TCP keep-alive period of the accepted connections.
+	// Zero means 3 minutes, negative disables keep-alives.
+	KeepAlivePeriod time.Duration
+
+	// DisableTCPNoDelay enables Nagle's algorithm on the accepted connections.
+	DisableTCPNoDelay bool
+
+	// ProxyProtocol, if set, reads the PROXY protocol header from the connections accepted
+	// on Listener and AdditionalListeners so that the remote address of their requests is
+	// the one of the client instead of the one of the proxy in front of the server.
+	ProxyProtocol *proxyproto.Options
+
+	// ConnectionLimits, if set, limits the connections accepted on Listener and on each of the
+	// AdditionalListeners. Every listener counts its connections on its own, so that a flood of
+	// one of them doesn't lock the clients of the others out. Connections exceeding the limits
+	// are closed right after they are accepted. The limit per IP applies to the address of the
+	// client, i.e. the one of the PROXY protocol header if ProxyProtocol is used.
+	ConnectionLimits *connlimit.Options
+
+	// connLimiters enforce ConnectionLimits on every listener once serving.
+	connLimiters atomic.Pointer[[]*connlimit.Listener]
 }
 
 // NewConfig returns a Config struct with default values.
@@ -53,12 +185,18 @@ func NewConfig() *Config {
 	lifecycleSignals := newLifecycleSignals()
 
 	return &Config{
-		LivezChecks:           append([]healthz.HealthzChecker{}, defaultHeathChecks...),
-		ReadyzChecks:          append([]healthz.HealthzChecker{}, defaultHeathChecks...),
-		RequestTimeout:        time.Duration(5) * time.Second,
-		MinRequestTimeout:     180,
-		ShutdownDelayDuration: time.Duration(0),
-		lifecycleSignals:      lifecycleSignals,
+		BuildHandlerChainFunc:       DefaultBuildHandlerChain,
+		LongRunningFunc:             genericfilters.BasicLongRunningRequestCheck(),
+		MaxRequestsInFlight:         400,
+		MaxMutatingRequestsInFlight: 200,
+		LivezChecks:                 append([]healthz.HealthzChecker{}, defaultHeathChecks...),
+		ReadyzChecks:                append([]healthz.HealthzChecker{}, defaultHeathChecks...),
+		HealthShowDetails:           healthz.ShowDetailsNever,
+		RequestTimeout:              time.Duration(5) * time.Second,
+		MinRequestTimeout:           180,
+		ShutdownDelayDuration:       time.Duration(0),
+		UpgradeTimeout:              time.Minute,
+		lifecycleSignals:            lifecycleSignals,
 	}
 }
 
@@ -85,7 +223,16 @@ type CompletedConfig struct {
 // New creates a new server which logically combines the handling chain with the passed server.
 // name is used to differentiate for logging.
 func (c completedConfig) New(name string) (*GenericAPIServer, error) {
+	if c.BuildHandlerChainFunc == nil {
+		return nil, fmt.Errorf("genericapiserver.New() called with config.BuildHandlerChainFunc == nil")
+	}
+
+	if err := genericfilters.ValidateRateLimitRules(c.RateLimits); err != nil {
+		return nil, err
+	}
+
 	apiServerHandler := NewAPIServerHandler()
+	c.BuildHandlerChainFunc(apiServerHandler.GoRestfulApp, c.Config)
 
 	s := &GenericAPIServer{
 		Handler: apiServerHandler,
@@ -93,17 +240,63 @@ func (c completedConfig) New(name string) (*GenericAPIServer, error) {
 		minRequestTimeout:     time.Duration(c.MinRequestTimeout) * time.Second,
 		ShutdownTimeout:       c.RequestTimeout,
 		ShutdownDelayDuration: c.ShutdownDelayDuration,
+		UpgradeSignal:         c.UpgradeSignal,
+		UpgradeTimeout:        c.UpgradeTimeout,
 		ServingInfo:           c.Serving,
 
-		livezChecks:      c.LivezChecks,
-		readyzChecks:     c.ReadyzChecks,
+		livezChecks:   c.LivezChecks,
+		readyzChecks:  c.ReadyzChecks,
+		startupChecks: c.StartupChecks,
+		healthOptions: healthz.ActuatorOptions{
+			HandlerOptions: healthz.HandlerOptions{
+				CheckTimeout: c.HealthCheckTimeout,
+				Timeout:      c.HealthTimeout,
+			},
+			ShowDetails: c.HealthShowDetails,
+			Authorized:  c.HealthDetailsAuthorizer,
+		},
+		maxInFlight:      c.maxInFlight,
 		lifecycleSignals: c.lifecycleSignals,
 	}
 
+	if c.Serving != nil && c.Serving.Cert != nil {
+		if err := s.AddReadyzChecks(servingCertCheck{c.Serving.Cert}); err != nil {
+			return nil, err
+		}
+	}
+
 	installAPI(s, c.Config)
 
 	return s, nil
 }
 
+// DefaultBuildHandlerChain installs the default middlewares in front of every route.
+func DefaultBuildHandlerChain(app *fiber.App, c *Config) {
+	app.Use(genericfilters.WithAuthentication(c.Authentication))
+	if len(c.RateLimits) > 0 {
+		store := c.RateLimitStore
+		if store == nil {
+			store = flowcontrol.NewMemoryRateLimitStore()
+		}
+		app.Use(genericfilters.WithRateLimit(c.RateLimits, store))
+	}
+	if c.FlowControl != nil {
+		app.Use(genericfilters.WithPriorityAndFairness(c.FlowControl, c.LongRunningFunc, healthPathPrefix))
+	} else if c.maxInFlight != nil {
+		app.Use(genericfilters.WithMaxInFlightLimit(c.maxInFlight, c.LongRunningFunc, healthPathPrefix))
+	}
+	app.Server().Handler = genericfilters.WithTimeoutForNonLongRunningRequests(app, app.Server().Handler,
+		c.LongRunningFunc, c.RequestTimeout, time.Duration(c.MinRequestTimeout)*time.Second)
+}
+
 func installAPI(s *GenericAPIServer, c *Config) {
+	authorized := c.DebuggingAuthorizer
+	if authorized == nil {
+		authorized = genericfilters.IsPrivileged
+	}
+	if c.FlowControl != nil && c.EnableFlowControlDebugging {
+		s.Handler.GoRestfulApp.Get("/debug/flowcontrol", genericfilters.WithAuthorization(authorized), func(ctx *fiber.Ctx) error {
+			return ctx.JSON(c.FlowControl.Dump())
+		})
+	}
 }
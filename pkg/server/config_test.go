@@ -0,0 +1,108 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ForbiddenR/apiserver/pkg/server/healthz"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+type fakeCheck struct {
+	name string
+	err  error
+}
+
+func (c fakeCheck) Name() string {
+	return c.name
+}
+
+func (c fakeCheck) Check(req *fasthttp.Request) error {
+	return c.err
+}
+
+// newTestServer creates a server from NewConfig after configure modified the config.
+func newTestServer(t *testing.T, configure func(c *Config)) *GenericAPIServer {
+	t.Helper()
+	config := NewConfig()
+	if configure != nil {
+		configure(config)
+	}
+	s, err := config.Complete().New("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// get sends a GET request for path to s and returns the status code and body.
+func get(t *testing.T, s *GenericAPIServer, path string) (int, string) {
+	t.Helper()
+	resp, err := s.Handler.GoRestfulApp.Test(httptest.NewRequest(http.MethodGet, path, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestConfigHealthChecks(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.LivezChecks = append(c.LivezChecks, fakeCheck{name: "live"})
+		c.ReadyzChecks = append(c.ReadyzChecks, fakeCheck{name: "ready"})
+		c.StartupChecks = append(c.StartupChecks, fakeCheck{name: "started"})
+	})
+	s.PrepareRun()
+
+	tests := []struct {
+		path     string
+		wantBody string
+	}{
+		{
+			path:     "/actuator/health/liveness?verbose",
+			wantBody: "[+]liveness ok\n[+]readiness ok\n[+]live ok\nliveness check passed\n",
+		},
+		{
+			path:     "/actuator/health/readiness?verbose",
+			wantBody: "[+]liveness ok\n[+]readiness ok\n[+]ready ok\n[+]shutdown ok\nreadiness check passed\n",
+		},
+		{
+			path:     "/actuator/health/startup?verbose&exclude=poststarthooks",
+			wantBody: "[+]started ok\n[+]poststarthooks excluded: ok\nstartup check passed\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			code, body := get(t, s, tt.path)
+			if code != fiber.StatusOK {
+				t.Errorf("status code = %d, want %d", code, fiber.StatusOK)
+			}
+			if body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestConfigStartupChecksFailure(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.StartupChecks = []healthz.HealthzChecker{fakeCheck{name: "started", err: io.EOF}}
+	})
+	s.PrepareRun()
+
+	code, body := get(t, s, "/actuator/health/startup?verbose&exclude=poststarthooks")
+	if code == fiber.StatusOK {
+		t.Errorf("status code = %d, want a failure", code)
+	}
+	want := "[-]started failed: EOF\n[+]poststarthooks excluded: ok\nstartup check failed\n"
+	if body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
@@ -0,0 +1,141 @@
+package dynamiccertificates
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// FileRefreshDuration is exposed so that integration tests can crank up the reload speed.
+var FileRefreshDuration = 1 * time.Minute
+
+var _ CertProvider = &DynamicCertKeyPairContent{}
+var _ ControllerRunner = &DynamicCertKeyPairContent{}
+var _ Notifier = &DynamicCertKeyPairContent{}
+
+// DynamicCertKeyPairContent provides a CertProvider that can dynamically react to new file content.
+type DynamicCertKeyPairContent struct {
+	name string
+
+	// certFile is the name of the certificate file to read.
+	certFile string
+	// keyFile is the name of the key file to read.
+	keyFile string
+
+	// certKeyPair is a certKeyContent that contains the last read, non-zero length content of the key and cert
+	certKeyPair atomic.Pointer[certKeyContent]
+
+	listenersLock sync.Mutex
+	listeners     []Listener
+}
+
+type certKeyContent struct {
+	cert []byte
+	key  []byte
+
+	tlsCert *tls.Certificate
+}
+
+// NewDynamicServingContentFromFiles returns a dynamic CertProvider based on a cert and key filename.
+// The files are read once on construction, an error is returned if they don't contain a valid pair.
+func NewDynamicServingContentFromFiles(purpose, certFile, keyFile string) (*DynamicCertKeyPairContent, error) {
+	if len(certFile) == 0 || len(keyFile) == 0 {
+		return nil, fmt.Errorf("missing filename for serving cert")
+	}
+	name := fmt.Sprintf("%s::%s::%s", purpose, certFile, keyFile)
+
+	ret := &DynamicCertKeyPairContent{
+		name:     name,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := ret.loadCertKeyPair(); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// loadCertKeyPair determines the next set of content for the file.
+// The current content is kept if the new pair isn't valid.
+func (c *DynamicCertKeyPairContent) loadCertKeyPair() error {
+	cert, err := os.ReadFile(c.certFile)
+	if err != nil {
+		return err
+	}
+	key, err := os.ReadFile(c.keyFile)
+	if err != nil {
+		return err
+	}
+	if len(cert) == 0 || len(key) == 0 {
+		return fmt.Errorf("missing content for serving cert %q", c.Name())
+	}
+
+	existing := c.certKeyPair.Load()
+	if existing != nil && bytes.Equal(existing.cert, cert) && bytes.Equal(existing.key, key) {
+		return nil
+	}
+
+	tlsCert, err := tls.X509KeyPair(cert, key)
+	if err != nil {
+		return fmt.Errorf("invalid serving cert keypair: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("invalid serving cert: %v", err)
+	}
+	if now := time.Now(); now.After(leaf.NotAfter) {
+		return fmt.Errorf("serving cert expired at %v", leaf.NotAfter)
+	}
+	tlsCert.Leaf = leaf
+
+	c.certKeyPair.Store(&certKeyContent{cert: cert, key: key, tlsCert: &tlsCert})
+	fmt.Printf("Loaded a new cert/key pair %q, valid until %v\n", c.Name(), leaf.NotAfter)
+	c.listenersLock.Lock()
+	listeners := c.listeners
+	c.listenersLock.Unlock()
+	for _, listener := range listeners {
+		listener.Enqueue()
+	}
+
+	return nil
+}
+
+// AddListener adds a listener to be notified when the cert/key pair changes.
+func (c *DynamicCertKeyPairContent) AddListener(listener Listener) {
+	c.listenersLock.Lock()
+	defer c.listenersLock.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+// Run polls the files every FileRefreshDuration until ctx is done.
+func (c *DynamicCertKeyPairContent) Run(ctx context.Context) {
+	ticker := time.NewTicker(FileRefreshDuration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := c.loadCertKeyPair(); err != nil {
+			fmt.Printf("Failed to reload %q, still serving the previous cert: %v\n", c.Name(), err)
+		}
+	}
+}
+
+// Name is just an identifier.
+func (c *DynamicCertKeyPairContent) Name() string {
+	return c.name
+}
+
+// CurrentCertificate returns the last valid certificate.
+func (c *DynamicCertKeyPairContent) CurrentCertificate() *tls.Certificate {
+	return c.certKeyPair.Load().tlsCert
+}
@@ -0,0 +1,28 @@
+package dynamiccertificates
+
+var _ SNICertProvider = &DynamicFileSNIContent{}
+var _ ControllerRunner = &DynamicFileSNIContent{}
+
+// DynamicFileSNIContent provides a SNICertProvider that can dynamically react to new file content.
+type DynamicFileSNIContent struct {
+	*DynamicCertKeyPairContent
+	sniNames []string
+}
+
+// NewDynamicSNIContentFromFiles returns a dynamic SNICertProvider based on a cert and key filename and explicit names.
+func NewDynamicSNIContentFromFiles(purpose, certFile, keyFile string, sniNames ...string) (*DynamicFileSNIContent, error) {
+	servingContent, err := NewDynamicServingContentFromFiles(purpose, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DynamicFileSNIContent{
+		DynamicCertKeyPairContent: servingContent,
+		sniNames:                  sniNames,
+	}, nil
+}
+
+// SNINames returns the explicit SNI names for the certificate.
+func (c *DynamicFileSNIContent) SNINames() []string {
+	return c.sniNames
+}
@@ -0,0 +1,41 @@
+package dynamiccertificates
+
+import (
+	"context"
+	"crypto/tls"
+)
+
+// CertProvider provides the certificate to serve.
+type CertProvider interface {
+	// Name is just an identifier.
+	Name() string
+	// CurrentCertificate returns the certificate to serve. It is never nil
+	// once the provider has been constructed successfully.
+	CurrentCertificate() *tls.Certificate
+}
+
+// ControllerRunner is a generic interface for starting a controller.
+type ControllerRunner interface {
+	// Run runs the controller until ctx is done.
+	Run(ctx context.Context)
+}
+
+// SNICertProvider provides a certificate to serve for the TLS server names it is responsible for.
+type SNICertProvider interface {
+	CertProvider
+	// SNINames returns the names the certificate is served for. If empty, the
+	// names are derived from the SANs, or the common name, of the certificate.
+	SNINames() []string
+}
+
+// Listener is notified when the content of a Notifier changes.
+type Listener interface {
+	// Enqueue is called after the content changed.
+	Enqueue()
+}
+
+// Notifier is a CertProvider whose content can change.
+type Notifier interface {
+	// AddListener adds a listener to be notified when the content changes.
+	AddListener(listener Listener)
+}
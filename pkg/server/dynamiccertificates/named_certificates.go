@@ -0,0 +1,49 @@
+package dynamiccertificates
+
+import (
+	"crypto/tls"
+	"strings"
+)
+
+// NameToCertificate maps the names of the given providers to their current certificate.
+// Names are taken from SNINames or, if empty, from the DNS SANs of the certificate, or
+// from its common name if it has no DNS SANs. Earlier providers take precedence.
+func NameToCertificate(sniCerts []SNICertProvider) map[string]*tls.Certificate {
+	byName := map[string]*tls.Certificate{}
+	for _, provider := range sniCerts {
+		cert := provider.CurrentCertificate()
+		names := provider.SNINames()
+		if len(names) == 0 && cert.Leaf != nil {
+			names = cert.Leaf.DNSNames
+			if len(names) == 0 && len(cert.Leaf.Subject.CommonName) > 0 {
+				names = []string{cert.Leaf.Subject.CommonName}
+			}
+		}
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, ok := byName[name]; !ok {
+				byName[name] = cert
+			}
+		}
+	}
+	return byName
+}
+
+// CertificateForName returns the certificate of byName for serverName, trying an
+// exact match first and a wildcard match of the first label second. It returns nil
+// if there is no match.
+func CertificateForName(byName map[string]*tls.Certificate, serverName string) *tls.Certificate {
+	name := strings.TrimSuffix(strings.ToLower(serverName), ".")
+	if cert, ok := byName[name]; ok {
+		return cert
+	}
+
+	labels := strings.Split(name, ".")
+	if len(labels) > 1 {
+		labels[0] = "*"
+		if cert, ok := byName[strings.Join(labels, ".")]; ok {
+			return cert
+		}
+	}
+	return nil
+}
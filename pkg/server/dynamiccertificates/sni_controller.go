@@ -0,0 +1,47 @@
+package dynamiccertificates
+
+import (
+	"crypto/tls"
+	"sync"
+)
+
+var _ Listener = &SNIController{}
+
+// SNIController selects the certificate of a TLS handshake by its server name.
+// It keeps the names of its providers mapped to their certificates and rebuilds
+// that mapping whenever one of them notifies it about new content.
+type SNIController struct {
+	sniCerts []SNICertProvider
+
+	lock   sync.RWMutex
+	byName map[string]*tls.Certificate
+}
+
+// NewSNIController returns a SNIController for sniCerts and registers it as a
+// listener of every provider which is a Notifier. Earlier providers take precedence.
+func NewSNIController(sniCerts []SNICertProvider) *SNIController {
+	c := &SNIController{sniCerts: sniCerts}
+	for _, provider := range sniCerts {
+		if notifier, ok := provider.(Notifier); ok {
+			notifier.AddListener(c)
+		}
+	}
+	c.Enqueue()
+	return c
+}
+
+// Enqueue rebuilds the mapping of names to certificates.
+func (c *SNIController) Enqueue() {
+	byName := NameToCertificate(c.sniCerts)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.byName = byName
+}
+
+// CertificateForName returns the certificate for serverName or nil if none matches.
+func (c *SNIController) CertificateForName(serverName string) *tls.Certificate {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return CertificateForName(c.byName, serverName)
+}
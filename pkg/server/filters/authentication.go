@@ -0,0 +1,29 @@
+package filters
+
+import (
+	"fmt"
+
+	"github.com/ForbiddenR/apiserver/pkg/authentication/authenticator"
+	"github.com/ForbiddenR/apiserver/pkg/endpoints/request"
+	"github.com/gofiber/fiber/v2"
+)
+
+// WithAuthentication stores the user authenticated by auth in the locals of the request,
+// see request.UserFrom. Requests without authentication information are passed on
+// anonymously, requests with invalid authentication information are rejected with a 401.
+func WithAuthentication(auth authenticator.Request) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if auth == nil {
+			return c.Next()
+		}
+		user, ok, err := auth.AuthenticateRequest(c)
+		if err != nil {
+			fmt.Printf("Unable to authenticate the request due to an error: %v\n", err)
+			return writeStatus(c, fiber.StatusUnauthorized, "Unauthorized", "Unauthorized")
+		}
+		if ok {
+			request.WithUser(c, user)
+		}
+		return c.Next()
+	}
+}
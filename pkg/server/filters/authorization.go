@@ -0,0 +1,35 @@
+package filters
+
+import (
+	"github.com/ForbiddenR/apiserver/pkg/authentication/user"
+	"github.com/ForbiddenR/apiserver/pkg/endpoints/request"
+	"github.com/gofiber/fiber/v2"
+)
+
+// WithAuthorization rejects requests which are not authenticated with a 401 and requests
+// which authorized returns false for with a 403. It expects WithAuthentication in front of it.
+func WithAuthorization(authorized func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := request.UserFrom(c); !ok {
+			return writeStatus(c, fiber.StatusUnauthorized, "Unauthorized", "Unauthorized")
+		}
+		if authorized == nil || !authorized(c) {
+			return writeStatus(c, fiber.StatusForbidden, "Forbidden", "Forbidden")
+		}
+		return c.Next()
+	}
+}
+
+// IsPrivileged returns true if the user of the request is in the user.SystemPrivilegedGroup group.
+func IsPrivileged(c *fiber.Ctx) bool {
+	u, ok := request.UserFrom(c)
+	if !ok {
+		return false
+	}
+	for _, group := range u.GetGroups() {
+		if group == user.SystemPrivilegedGroup {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package filters
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LongRunningRequestCheck is a predicate which is true for long-running http requests.
+type LongRunningRequestCheck func(c *fiber.Ctx) bool
+
+// BasicLongRunningRequestCheck returns true if the request is a watch, i.e. it
+// has the query parameter watch=true, or if its path starts with one of pathPrefixes.
+func BasicLongRunningRequestCheck(pathPrefixes ...string) LongRunningRequestCheck {
+	return func(c *fiber.Ctx) bool {
+		if watch := c.Query("watch"); watch == "true" || watch == "1" {
+			return true
+		}
+		path := c.Path()
+		for _, prefix := range pathPrefixes {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
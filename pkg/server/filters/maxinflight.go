@@ -0,0 +1,94 @@
+package filters
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MaxInFlightLimit bounds the number of requests served concurrently, with separate
+// budgets for mutating and read-only requests. Zero means unlimited.
+type MaxInFlightLimit struct {
+	nonMutatingChan chan struct{}
+	mutatingChan    chan struct{}
+}
+
+// NewMaxInFlightLimit returns a MaxInFlightLimit allowing nonMutatingLimit read-only
+// and mutatingLimit mutating requests in flight.
+func NewMaxInFlightLimit(nonMutatingLimit, mutatingLimit int) *MaxInFlightLimit {
+	l := &MaxInFlightLimit{}
+	if nonMutatingLimit > 0 {
+		l.nonMutatingChan = make(chan struct{}, nonMutatingLimit)
+	}
+	if mutatingLimit > 0 {
+		l.mutatingChan = make(chan struct{}, mutatingLimit)
+	}
+	return l
+}
+
+// InFlight returns the number of read-only and mutating requests currently in flight
+// which are subject to a limit.
+func (l *MaxInFlightLimit) InFlight() (nonMutating, mutating int) {
+	return len(l.nonMutatingChan), len(l.mutatingChan)
+}
+
+// WithMaxInFlightLimit rejects requests with 429 and a Retry-After header once the
+// in-flight budget of their kind is exhausted. Long running requests and requests
+// under one of exemptPathPrefixes, e.g. the health endpoints, are never rejected.
+func WithMaxInFlightLimit(limit *MaxInFlightLimit, longRunning LongRunningRequestCheck, exemptPathPrefixes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if longRunning != nil && longRunning(c) {
+			return c.Next()
+		}
+		if hasPathPrefix(c.Path(), exemptPathPrefixes...) {
+			return c.Next()
+		}
+
+		ch := limit.nonMutatingChan
+		if isMutatingMethod(c.Method()) {
+			ch = limit.mutatingChan
+		}
+		if ch == nil {
+			return c.Next()
+		}
+
+		select {
+		case ch <- struct{}{}:
+			defer func() { <-ch }()
+			return c.Next()
+		default:
+			return tooManyRequests(c, 1)
+		}
+	}
+}
+
+// hasPathPrefix returns true if path is one of prefixes or below one of them,
+// i.e. "/healthz" matches "/healthz" and "/healthz/ping", but not "/healthzfoo".
+func hasPathPrefix(path string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// tooManyRequests asks the client to retry the request after the given number of seconds, at least one.
+func tooManyRequests(c *fiber.Ctx, retryAfterSeconds int) error {
+	if retryAfterSeconds < 1 {
+		retryAfterSeconds = 1
+	}
+	err := writeStatus(c, fiber.StatusTooManyRequests, "TooManyRequests", "Too many requests, please try again later.")
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfterSeconds))
+	return err
+}
@@ -0,0 +1,148 @@
+package filters
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// blockingApp returns an app limited by limit whose requests with the query parameter
+// block signal entered and wait for release.
+func blockingApp(limit *MaxInFlightLimit, entered, release chan struct{}) *fiber.App {
+	app := fiber.New()
+	app.Use(WithMaxInFlightLimit(limit, BasicLongRunningRequestCheck("/watch"), "/actuator/health"))
+	app.All("/*", func(c *fiber.Ctx) error {
+		if len(c.Query("block")) > 0 {
+			entered <- struct{}{}
+			<-release
+		}
+		return c.SendString("ok")
+	})
+	return app
+}
+
+func TestWithMaxInFlightLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		// inFlight is the method of the request which is in flight while method is sent.
+		inFlight string
+		method   string
+		path     string
+		wantCode int
+	}{
+		{name: "read-only budget exhausted", inFlight: http.MethodGet, method: http.MethodGet, path: "/api", wantCode: fiber.StatusTooManyRequests},
+		{name: "mutating budget exhausted", inFlight: http.MethodPost, method: http.MethodDelete, path: "/api", wantCode: fiber.StatusTooManyRequests},
+		{name: "separate mutating budget", inFlight: http.MethodGet, method: http.MethodPost, path: "/api", wantCode: fiber.StatusOK},
+		{name: "separate read-only budget", inFlight: http.MethodPut, method: http.MethodGet, path: "/api", wantCode: fiber.StatusOK},
+		{name: "long running", inFlight: http.MethodGet, method: http.MethodGet, path: "/watch/pods", wantCode: fiber.StatusOK},
+		{name: "long running query", inFlight: http.MethodGet, method: http.MethodGet, path: "/api?watch=true", wantCode: fiber.StatusOK},
+		{name: "exempt prefix", inFlight: http.MethodGet, method: http.MethodGet, path: "/actuator/health", wantCode: fiber.StatusOK},
+		{name: "below exempt prefix", inFlight: http.MethodGet, method: http.MethodGet, path: "/actuator/health/x", wantCode: fiber.StatusOK},
+		{name: "sibling of exempt prefix", inFlight: http.MethodGet, method: http.MethodGet, path: "/actuator/healthx", wantCode: fiber.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := NewMaxInFlightLimit(1, 1)
+			entered, release := make(chan struct{}), make(chan struct{})
+			app := blockingApp(limit, entered, release)
+
+			done := make(chan error)
+			go func() {
+				resp, err := app.Test(httptest.NewRequest(tt.inFlight, "/api?block=true", nil), -1)
+				if err == nil {
+					resp.Body.Close()
+				}
+				done <- err
+			}()
+			<-entered
+			defer func() {
+				close(release)
+				if err := <-done; err != nil {
+					t.Errorf("request in flight failed: %v", err)
+				}
+			}()
+
+			resp, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("status code = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			if tt.wantCode != fiber.StatusTooManyRequests {
+				return
+			}
+			if retryAfter := resp.Header.Get(fiber.HeaderRetryAfter); retryAfter != "1" {
+				t.Errorf("Retry-After = %q, want 1", retryAfter)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var status Status
+			if err := json.Unmarshal(body, &status); err != nil {
+				t.Fatalf("invalid body %q: %v", body, err)
+			}
+			if status.Code != fiber.StatusTooManyRequests || status.Reason != "TooManyRequests" {
+				t.Errorf("status = %+v, want too many requests", status)
+			}
+		})
+	}
+}
+
+func TestMaxInFlightLimitInFlight(t *testing.T) {
+	limit := NewMaxInFlightLimit(2, 0)
+	entered, release := make(chan struct{}), make(chan struct{})
+	app := blockingApp(limit, entered, release)
+
+	done := make(chan struct{})
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		go func(method string) {
+			defer func() { done <- struct{}{} }()
+			resp, err := app.Test(httptest.NewRequest(method, "/api?block=true", nil), -1)
+			if err == nil {
+				resp.Body.Close()
+			}
+		}(method)
+		<-entered
+	}
+
+	// mutating requests are unlimited, they aren't counted.
+	if nonMutating, mutating := limit.InFlight(); nonMutating != 1 || mutating != 0 {
+		t.Errorf("InFlight() = %d, %d, want 1, 0", nonMutating, mutating)
+	}
+	close(release)
+	<-done
+	<-done
+	if nonMutating, mutating := limit.InFlight(); nonMutating != 0 || mutating != 0 {
+		t.Errorf("InFlight() after the requests = %d, %d, want 0, 0", nonMutating, mutating)
+	}
+}
+
+func TestHasPathPrefix(t *testing.T) {
+	tests := []struct {
+		path     string
+		prefixes []string
+		want     bool
+	}{
+		{path: "/actuator/health", prefixes: []string{"/actuator/health"}, want: true},
+		{path: "/actuator/health/x", prefixes: []string{"/actuator/health"}, want: true},
+		{path: "/actuator/health/x", prefixes: []string{"/actuator/health/"}, want: true},
+		{path: "/actuator/healthx", prefixes: []string{"/actuator/health"}, want: false},
+		{path: "/actuator", prefixes: []string{"/actuator/health"}, want: false},
+		{path: "/api", prefixes: []string{"/apis", "/api"}, want: true},
+		{path: "/api", prefixes: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := hasPathPrefix(tt.path, tt.prefixes...); got != tt.want {
+				t.Errorf("hasPathPrefix(%q, %q) = %v, want %v", tt.path, tt.prefixes, got, tt.want)
+			}
+		})
+	}
+}
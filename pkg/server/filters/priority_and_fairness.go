@@ -0,0 +1,46 @@
+package filters
+
+import (
+	"github.com/ForbiddenR/apiserver/pkg/endpoints/request"
+	"github.com/ForbiddenR/apiserver/pkg/util/flowcontrol"
+	"github.com/gofiber/fiber/v2"
+)
+
+// WithPriorityAndFairness admits requests through the fair queuing of controller and rejects
+// them with 429 and a Retry-After header if they are not admitted. Long running requests and
+// requests under one of exemptPathPrefixes, e.g. the health endpoints, are never queued.
+//
+// fasthttp doesn't notice a client going away while its request is handled, so the user context
+// of the request is not cancelled then. A queued request of a client which went away keeps its
+// place until it gets a seat or it is rejected at the queue wait timeout or the deadline of the
+// request set by WithTimeoutForNonLongRunningRequests, whichever comes first.
+func WithPriorityAndFairness(controller *flowcontrol.Controller, longRunning LongRunningRequestCheck, exemptPathPrefixes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if longRunning != nil && longRunning(c) {
+			return c.Next()
+		}
+		path := c.Path()
+		if hasPathPrefix(path, exemptPathPrefixes...) {
+			return c.Next()
+		}
+
+		digest := &flowcontrol.RequestDigest{
+			Method:   c.Method(),
+			Path:     path,
+			ClientIP: c.IP(),
+			Header: func(name string) string {
+				return c.Get(name)
+			},
+		}
+		if user, ok := request.UserFrom(c); ok {
+			digest.User = user
+		}
+
+		var err error
+		// the user context is done at the deadline of the request, see above.
+		if !controller.Handle(c.UserContext(), digest, func() { err = c.Next() }) {
+			return tooManyRequests(c, 1)
+		}
+		return err
+	}
+}
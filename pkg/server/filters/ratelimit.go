@@ -0,0 +1,188 @@
+package filters
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ForbiddenR/apiserver/pkg/endpoints/request"
+	"github.com/ForbiddenR/apiserver/pkg/util/flowcontrol"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RateLimitRule limits the requests of every client identity to a route with a token bucket.
+type RateLimitRule struct {
+	// Name identifies the rule, the buckets of different rules are independent.
+	Name string
+	// Route is the path pattern of the limited requests. Segments starting with ':' match any
+	// single non-empty segment and a trailing '*' matches any remainder, including none, e.g.
+	// "/api/v1/users/:name", or "/api/*" which matches "/api" and everything below it.
+	Route string
+	// Methods restricts the rule to requests with one of these methods. All methods if empty.
+	Methods []string
+	// QPS is the number of requests per second every identity may send on average.
+	QPS float64
+	// Burst is the number of requests every identity may send at once.
+	Burst int
+	// Identity returns the client identity requests are limited by. nil means IdentityByUser.
+	Identity func(c *fiber.Ctx) string
+}
+
+// IdentityByUser identifies clients by the name of their user, anonymous clients by their IP.
+func IdentityByUser(c *fiber.Ctx) string {
+	if user, ok := request.UserFrom(c); ok {
+		return "user:" + user.GetName()
+	}
+	return IdentityByClientIP(c)
+}
+
+// IdentityByClientIP identifies clients by their IP.
+func IdentityByClientIP(c *fiber.Ctx) string {
+	return "ip:" + c.IP()
+}
+
+// IdentityByHeader identifies clients by an API key sent in the header named name, clients
+// without it by their IP. The key is hashed so that it isn't kept in the store.
+func IdentityByHeader(name string) func(c *fiber.Ctx) string {
+	return func(c *fiber.Ctx) string {
+		key := c.Get(name)
+		if len(key) == 0 {
+			return IdentityByClientIP(c)
+		}
+		sum := sha256.Sum256([]byte(key))
+		return "key:" + hex.EncodeToString(sum[:])
+	}
+}
+
+// ValidateRateLimitRules returns an error if a rule can't be enforced.
+func ValidateRateLimitRules(rules []RateLimitRule) error {
+	names := map[string]bool{}
+	for i, rule := range rules {
+		if len(rule.Name) == 0 {
+			return fmt.Errorf("rate limit rule %d must have a name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rate limit rule %q is configured twice", rule.Name)
+		}
+		names[rule.Name] = true
+		if !strings.HasPrefix(rule.Route, "/") {
+			return fmt.Errorf("rate limit rule %q: route %q must start with '/'", rule.Name, rule.Route)
+		}
+		if rule.QPS <= 0 {
+			return fmt.Errorf("rate limit rule %q: QPS must be positive", rule.Name)
+		}
+		if rule.Burst <= 0 {
+			return fmt.Errorf("rate limit rule %q: Burst must be positive", rule.Name)
+		}
+	}
+	return nil
+}
+
+// WithRateLimit takes a token of every rule matching the request from the bucket of the
+// client identity in store, and rejects the request with 429 and a Retry-After header if
+// one of them is exhausted. The tokens taken from the other buckets are returned then so
+// that a rejected request doesn't count against any rule. The RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers report the most restrictive of the
+// matching rules. Requests are let through if the store fails.
+func WithRateLimit(rules []RateLimitRule, store flowcontrol.RateLimitStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var tightest *flowcontrol.TakeResult
+		var taken []*RateLimitRule
+		var takenKeys []string
+		allowed := true
+		for i := range rules {
+			rule := &rules[i]
+			if !rule.matches(c) {
+				continue
+			}
+			identity := rule.Identity
+			if identity == nil {
+				identity = IdentityByUser
+			}
+			key := rule.Name + "|" + identity(c)
+
+			result, err := store.Take(c.UserContext(), key, rule.QPS, rule.Burst)
+			if err != nil {
+				fmt.Printf("Unable to rate limit the request by rule %q: %v\n", rule.Name, err)
+				continue
+			}
+			if result.Allowed {
+				taken = append(taken, rule)
+				takenKeys = append(takenKeys, key)
+			}
+			allowed = allowed && result.Allowed
+			if tightest == nil || !result.Allowed || (tightest.Allowed && result.Remaining < tightest.Remaining) {
+				tightest = &result
+			}
+		}
+		if tightest == nil {
+			return c.Next()
+		}
+
+		if !allowed {
+			for i, rule := range taken {
+				if err := store.Return(c.UserContext(), takenKeys[i], rule.QPS, rule.Burst); err != nil {
+					fmt.Printf("Unable to return the token of rule %q: %v\n", rule.Name, err)
+				}
+			}
+			err := tooManyRequests(c, seconds(tightest.RetryAfter))
+			setRateLimitHeaders(c, tightest)
+			return err
+		}
+		err := c.Next()
+		setRateLimitHeaders(c, tightest)
+		return err
+	}
+}
+
+func (rule *RateLimitRule) matches(c *fiber.Ctx) bool {
+	if len(rule.Methods) > 0 {
+		found := false
+		for _, method := range rule.Methods {
+			if strings.EqualFold(method, c.Method()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return matchRoute(rule.Route, c.Path())
+}
+
+// matchRoute returns whether path matches the route pattern of a RateLimitRule.
+func matchRoute(route, path string) bool {
+	routeSegments := strings.Split(strings.Trim(route, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range routeSegments {
+		if segment == "*" && i == len(routeSegments)-1 {
+			return true
+		}
+		if i >= len(pathSegments) {
+			return false
+		}
+		if strings.HasPrefix(segment, ":") && len(pathSegments[i]) > 0 {
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return len(routeSegments) == len(pathSegments)
+}
+
+func setRateLimitHeaders(c *fiber.Ctx, result *flowcontrol.TakeResult) {
+	c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Set("RateLimit-Reset", strconv.Itoa(seconds(result.Reset)))
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
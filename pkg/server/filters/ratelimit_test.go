@@ -0,0 +1,199 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ForbiddenR/apiserver/pkg/util/flowcontrol"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestMatchRoute(t *testing.T) {
+	tests := []struct {
+		route string
+		path  string
+		want  bool
+	}{
+		{route: "/", path: "/", want: true},
+		{route: "/", path: "/api", want: false},
+		{route: "/api", path: "/api", want: true},
+		{route: "/api", path: "/api/", want: true},
+		{route: "/api", path: "/apis", want: false},
+		{route: "/api", path: "/api/v1", want: false},
+		{route: "/api/*", path: "/api", want: true},
+		{route: "/api/*", path: "/api/v1", want: true},
+		{route: "/api/*", path: "/api/v1/users/alice", want: true},
+		{route: "/api/*", path: "/apis/v1", want: false},
+		{route: "/*", path: "/", want: true},
+		{route: "/*", path: "/api/v1", want: true},
+		{route: "/api/*/users", path: "/api/v1/users", want: false},
+		{route: "/users/:name", path: "/users/alice", want: true},
+		{route: "/users/:name", path: "/users", want: false},
+		{route: "/users/:name", path: "/users/", want: false},
+		{route: "/users/:name", path: "/users/alice/keys", want: false},
+		{route: "/users/:name/keys", path: "/users/alice/keys", want: true},
+		{route: "/users/:name/keys", path: "/users//keys", want: false},
+		{route: "/users/:name/*", path: "/users/alice/keys/1", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route+" "+tt.path, func(t *testing.T) {
+			if got := matchRoute(tt.route, tt.path); got != tt.want {
+				t.Errorf("matchRoute(%q, %q) = %v, want %v", tt.route, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+// failingStore fails every call.
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, qps float64, burst int) (flowcontrol.TakeResult, error) {
+	return flowcontrol.TakeResult{}, errors.New("unavailable")
+}
+
+func (failingStore) Return(ctx context.Context, key string, qps float64, burst int) error {
+	return errors.New("unavailable")
+}
+
+func TestWithRateLimit(t *testing.T) {
+	byClient := func(c *fiber.Ctx) string { return c.Get("X-Client") }
+	// the buckets don't refill noticeably while the test runs, a token takes 1000s.
+	rules := []RateLimitRule{
+		{Name: "all", Route: "/*", QPS: 0.001, Burst: 3, Identity: byClient},
+		{Name: "users", Route: "/users/:name", QPS: 0.001, Burst: 1, Identity: byClient},
+		{Name: "writes", Route: "/*", Methods: []string{"post"}, QPS: 0.001, Burst: 1, Identity: byClient},
+	}
+	app := fiber.New()
+	app.Use(WithRateLimit(rules, flowcontrol.NewMemoryRateLimitStore()))
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	// the requests are sent in order, they share the buckets.
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		client string
+		// wantCode 429 expects a Retry-After header of wantRetryAfter.
+		wantCode       int
+		wantRetryAfter string
+		// wantLimit, wantRemaining and wantReset are the RateLimit-* headers.
+		wantLimit     string
+		wantRemaining string
+		wantReset     string
+	}{
+		{
+			name: "first request", method: http.MethodGet, path: "/users/alice", client: "a",
+			wantCode: fiber.StatusOK, wantLimit: "1", wantRemaining: "0", wantReset: "1000",
+		},
+		{
+			name: "exhausted rule", method: http.MethodGet, path: "/users/bob", client: "a",
+			wantCode: fiber.StatusTooManyRequests, wantRetryAfter: "1000", wantLimit: "1", wantRemaining: "0", wantReset: "1000",
+		},
+		{
+			// the token of "all" taken by the rejected request was returned.
+			name: "token returned", method: http.MethodGet, path: "/other", client: "a",
+			wantCode: fiber.StatusOK, wantLimit: "3", wantRemaining: "1", wantReset: "2000",
+		},
+		{
+			name: "method restricted rule", method: http.MethodPost, path: "/other", client: "a",
+			wantCode: fiber.StatusOK, wantLimit: "3", wantRemaining: "0", wantReset: "3000",
+		},
+		{
+			// "all" and "writes" are exhausted, the headers report the last one.
+			name: "all rules exhausted", method: http.MethodPost, path: "/other", client: "a",
+			wantCode: fiber.StatusTooManyRequests, wantRetryAfter: "1000", wantLimit: "1", wantRemaining: "0", wantReset: "1000",
+		},
+		{
+			name: "other client", method: http.MethodGet, path: "/users/alice", client: "b",
+			wantCode: fiber.StatusOK, wantLimit: "1", wantRemaining: "0", wantReset: "1000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("X-Client", tt.client)
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status code = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			for header, want := range map[string]string{
+				fiber.HeaderRetryAfter: tt.wantRetryAfter,
+				"RateLimit-Limit":      tt.wantLimit,
+				"RateLimit-Remaining":  tt.wantRemaining,
+				"RateLimit-Reset":      tt.wantReset,
+			} {
+				if got := resp.Header.Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestWithRateLimitWithoutMatchingRule(t *testing.T) {
+	tests := []struct {
+		name  string
+		store flowcontrol.RateLimitStore
+		path  string
+	}{
+		{name: "no matching rule", store: flowcontrol.NewMemoryRateLimitStore(), path: "/other"},
+		{name: "failing store", store: failingStore{}, path: "/api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(WithRateLimit([]RateLimitRule{{Name: "api", Route: "/api/*", QPS: 0.001, Burst: 1}}, tt.store))
+			app.All("/*", func(c *fiber.Ctx) error {
+				return c.SendString("ok")
+			})
+
+			for i := 0; i < 3; i++ {
+				resp, err := app.Test(httptest.NewRequest(http.MethodGet, tt.path, nil), -1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != fiber.StatusOK {
+					t.Errorf("status code of request %d = %d, want %d", i, resp.StatusCode, fiber.StatusOK)
+				}
+				if limit := resp.Header.Get("RateLimit-Limit"); len(limit) > 0 {
+					t.Errorf("RateLimit-Limit = %q, want none", limit)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRateLimitRules(t *testing.T) {
+	valid := RateLimitRule{Name: "api", Route: "/api/*", QPS: 1, Burst: 1}
+	tests := []struct {
+		name    string
+		rules   []RateLimitRule
+		wantErr bool
+	}{
+		{name: "valid", rules: []RateLimitRule{valid}},
+		{name: "none"},
+		{name: "unnamed", rules: []RateLimitRule{{Route: "/", QPS: 1, Burst: 1}}, wantErr: true},
+		{name: "duplicate", rules: []RateLimitRule{valid, valid}, wantErr: true},
+		{name: "relative route", rules: []RateLimitRule{{Name: "api", Route: "api", QPS: 1, Burst: 1}}, wantErr: true},
+		{name: "no QPS", rules: []RateLimitRule{{Name: "api", Route: "/api", Burst: 1}}, wantErr: true},
+		{name: "no burst", rules: []RateLimitRule{{Name: "api", Route: "/api", QPS: 1}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateRateLimitRules(tt.rules); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRateLimitRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
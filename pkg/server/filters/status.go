@@ -0,0 +1,44 @@
+package filters
+
+import (
+	"encoding/json"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// Status is the structured body of the responses written by the filters of
+// this package when they reject a request.
+type Status struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
+	Code    int    `json:"code"`
+}
+
+func newFailureStatus(code int, reason, message string) *Status {
+	return &Status{
+		Status:  "Failure",
+		Message: message,
+		Reason:  reason,
+		Code:    code,
+	}
+}
+
+// writeStatus replaces whatever has been written to the response so far with
+// a Status failure.
+func writeStatus(c *fiber.Ctx, code int, reason, message string) error {
+	c.Response().Reset()
+	return c.Status(code).JSON(newFailureStatus(code, reason, message))
+}
+
+// statusResponse returns a response with a Status failure for the cases in which
+// the fiber context of the request can't be used.
+func statusResponse(code int, reason, message string) *fasthttp.Response {
+	resp := &fasthttp.Response{}
+	resp.SetStatusCode(code)
+	resp.Header.SetContentType(fiber.MIMEApplicationJSON)
+	body, _ := json.Marshal(newFailureStatus(code, reason, message))
+	resp.SetBody(body)
+	return resp
+}
@@ -0,0 +1,72 @@
+package filters
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// WithTimeoutForNonLongRunningRequests wraps handler, the handler of app, so that non-long-running
+// requests time out after the given timeout. The deadline is set on the user context of the request,
+// handlers are expected to honor it by passing c.UserContext() to the calls they make. At the deadline
+// the client is answered with a 504 Status, even if the handler hasn't returned yet. It keeps running
+// in the background, but its response is discarded.
+// Long running requests get a random deadline between minRequestTimeout and twice that value
+// instead, it is up to their handlers to ignore or honor it. They are never answered with a 504.
+func WithTimeoutForNonLongRunningRequests(app *fiber.App, handler fasthttp.RequestHandler, longRunning LongRunningRequestCheck, timeout, minRequestTimeout time.Duration) fasthttp.RequestHandler {
+	return func(rctx *fasthttp.RequestCtx) {
+		// the fiber context of the request only lives as long as handler runs, so the
+		// user context is set on a context of its own.
+		c := app.AcquireCtx(rctx)
+		isLongRunning := longRunning != nil && longRunning(c)
+		requestTimeout := timeout
+		if isLongRunning {
+			requestTimeout = 0
+			if minRequestTimeout > 0 {
+				requestTimeout = randomizedTimeout(minRequestTimeout)
+			}
+		}
+		if requestTimeout <= 0 {
+			app.ReleaseCtx(c)
+			handler(rctx)
+			return
+		}
+		ctx, cancel := context.WithTimeout(c.UserContext(), requestTimeout)
+		defer cancel()
+		c.SetUserContext(ctx)
+		app.ReleaseCtx(c)
+
+		if isLongRunning {
+			handler(rctx)
+			return
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			handler(rctx)
+		}()
+
+		select {
+		case <-done:
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				rctx.Response.Reset()
+				statusResponse(fiber.StatusGatewayTimeout, "Timeout", timeoutMessage).CopyTo(&rctx.Response)
+			}
+		case <-ctx.Done():
+			// rctx is still used by handler, fasthttp doesn't reuse it once it timed out.
+			rctx.TimeoutErrorWithResponse(statusResponse(fiber.StatusGatewayTimeout, "Timeout", timeoutMessage))
+		}
+	}
+}
+
+const timeoutMessage = "Timeout: request did not complete within the allotted timeout"
+
+// randomizedTimeout returns a random duration in [min, 2*min).
+func randomizedTimeout(min time.Duration) time.Duration {
+	return time.Duration(float64(min) * (rand.Float64() + 1.0))
+}
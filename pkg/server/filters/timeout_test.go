@@ -0,0 +1,160 @@
+package filters
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWithTimeoutForNonLongRunningRequests(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	app := fiber.New()
+	app.Get("/fast", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+	app.Get("/ignoring", func(c *fiber.Ctx) error {
+		<-stopCh
+		return c.SendString("too late")
+	})
+	app.Get("/honoring", func(c *fiber.Ctx) error {
+		<-c.UserContext().Done()
+		return c.SendString(c.UserContext().Err().Error())
+	})
+	app.Get("/watch", func(c *fiber.Ctx) error {
+		time.Sleep(2 * timeout)
+		if _, ok := c.UserContext().Deadline(); ok {
+			return c.SendString("deadline")
+		}
+		return c.SendString("ok")
+	})
+	app.Server().Handler = WithTimeoutForNonLongRunningRequests(app, app.Server().Handler,
+		BasicLongRunningRequestCheck("/watch"), timeout, 0)
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		// wantBody is compared if set, the body of a 504 is checked to be a timeout Status.
+		wantBody    string
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{
+			name:        "fast",
+			path:        "/fast",
+			wantCode:    fiber.StatusOK,
+			wantBody:    "ok",
+			maxDuration: timeout,
+		},
+		{
+			name:        "handler ignoring the deadline",
+			path:        "/ignoring",
+			wantCode:    fiber.StatusGatewayTimeout,
+			minDuration: timeout,
+			maxDuration: 3 * timeout,
+		},
+		{
+			name:        "handler honoring the deadline",
+			path:        "/honoring",
+			wantCode:    fiber.StatusGatewayTimeout,
+			minDuration: timeout,
+			maxDuration: 3 * timeout,
+		},
+		{
+			name:        "long running",
+			path:        "/watch",
+			wantCode:    fiber.StatusOK,
+			wantBody:    "ok",
+			minDuration: 2 * timeout,
+			maxDuration: 5 * timeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tt.path, nil), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			elapsed := time.Since(start)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("status code = %d, want %d", resp.StatusCode, tt.wantCode)
+			}
+			if elapsed < tt.minDuration || elapsed > tt.maxDuration {
+				t.Errorf("request took %v, want between %v and %v", elapsed, tt.minDuration, tt.maxDuration)
+			}
+			if tt.wantCode != fiber.StatusGatewayTimeout {
+				if string(body) != tt.wantBody {
+					t.Errorf("body = %q, want %q", body, tt.wantBody)
+				}
+				return
+			}
+			var status Status
+			if err := json.Unmarshal(body, &status); err != nil {
+				t.Fatalf("invalid body %q: %v", body, err)
+			}
+			if status.Code != fiber.StatusGatewayTimeout || status.Reason != "Timeout" || status.Message != timeoutMessage {
+				t.Errorf("status = %+v, want a timeout", status)
+			}
+		})
+	}
+}
+
+func TestLongRunningRequestDeadline(t *testing.T) {
+	const minRequestTimeout = time.Minute
+
+	app := fiber.New()
+	app.Get("/watch", func(c *fiber.Ctx) error {
+		deadline, ok := c.UserContext().Deadline()
+		if !ok {
+			return c.SendString("none")
+		}
+		return c.SendString(time.Until(deadline).String())
+	})
+	app.Server().Handler = WithTimeoutForNonLongRunningRequests(app, app.Server().Handler,
+		BasicLongRunningRequestCheck("/watch"), time.Millisecond, minRequestTimeout)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/watch", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status code = %d, want %d", resp.StatusCode, fiber.StatusOK)
+	}
+	remaining, err := time.ParseDuration(string(body))
+	if err != nil {
+		t.Fatalf("unexpected body %q: %v", body, err)
+	}
+	// the deadline is set right before the handler runs.
+	if remaining < minRequestTimeout-time.Second || remaining >= 2*minRequestTimeout {
+		t.Errorf("deadline in %v, want between %v and %v", remaining, minRequestTimeout, 2*minRequestTimeout)
+	}
+}
+
+func TestRandomizedTimeout(t *testing.T) {
+	const min = time.Second
+	for i := 0; i < 1000; i++ {
+		if got := randomizedTimeout(min); got < min || got >= 2*min {
+			t.Fatalf("randomizedTimeout(%v) = %v, want it in [%v, %v)", min, got, min, 2*min)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 
+	genericfilters "github.com/ForbiddenR/apiserver/pkg/server/filters"
 	"github.com/ForbiddenR/apiserver/pkg/server/healthz"
+	"github.com/ForbiddenR/apiserver/pkg/util/activation"
 )
 
 type APIGroupInfo struct {
@@ -36,16 +40,52 @@ type GenericAPIServer struct {
 	readyzLock            sync.Mutex
 	readyzChecks          []healthz.HealthzChecker
 	readyzChecksInstalled bool
+	// startup checks
+	startupLock            sync.Mutex
+	startupChecks          []healthz.HealthzChecker
+	startupChecksInstalled bool
+	// latchedStartupChecks are the startup checks served by the startup endpoint.
+	latchedStartupChecks []healthz.HealthzChecker
+	// healthOptions configures the aggregated /actuator/health document.
+	healthOptions healthz.ActuatorOptions
+
+	// PostStartHooks are each called after the server has started listening, in a separate go func for each
+	// with no guarantee of ordering between them. The map key is a name used for error reporting.
+	postStartHookLock    sync.Mutex
+	postStartHooks       map[string]postStartHookEntry
+	postStartHooksCalled bool
+
+	// PreShutdownHooks are called once shutdown is initiated, before the server stops accepting new requests.
+	preShutdownHookLock    sync.Mutex
+	preShutdownHooks       map[string]preShutdownHookEntry
+	preShutdownHooksCalled bool
 
 	// ShutdownDelayDuration allows to block shutdown for some time.
 	// during this time, the API server keeps serving, /healthz will return 200,
 	// but /readyz will return failure.
 	ShutdownDelayDuration time.Duration
 
+	// maxInFlight is the in-flight budget of the handler chain, nil if there is none.
+	maxInFlight *genericfilters.MaxInFlightLimit
+
+	// UpgradeSignal starts a new process which takes over the listeners, nil disables upgrades.
+	UpgradeSignal os.Signal
+	// UpgradeTimeout bounds how long an upgrade waits for the new process to become ready.
+	UpgradeTimeout time.Duration
+
 	// lifecycleSignals provides access to teh various signals that happen during the life cycle of the apiserver.
 	lifecycleSignals lifecycleSignals
 }
 
+// RequestsInFlight returns the number of read-only and mutating requests currently
+// counted against MaxRequestsInFlight and MaxMutatingRequestsInFlight.
+func (s *GenericAPIServer) RequestsInFlight() (nonMutating, mutating int) {
+	if s.maxInFlight == nil {
+		return 0, 0
+	}
+	return s.maxInFlight.InFlight()
+}
+
 func (s *GenericAPIServer) InstallAPIGroups(apiGroupInfos ...*APIGroupInfo) error {
 	for range apiGroupInfos {
 		s.Handler.GoRestfulApp.Group("")
@@ -74,6 +114,15 @@ func (s *GenericAPIServer) PrepareRun() preparedGenericAPIServer {
 	}
 	s.installReadyz()
 
+	// startup is not complete before all post-start hooks have completed.
+	postStartHooksCompletedCh := s.lifecycleSignals.PostStartHooksCompleted.Signaled()
+	err = s.AddStartupChecks(postStartHooksCheck{CompletedCh: postStartHooksCompletedCh, Failure: s.postStartHooksFailure})
+	if err != nil {
+		fmt.Printf("Failed to install startup post-start hooks check %s", err)
+	}
+	s.installStartup()
+	s.installActuatorHealth()
+
 	return preparedGenericAPIServer{s}
 }
 
@@ -84,6 +133,11 @@ func (s preparedGenericAPIServer) Run(stopCh <-chan struct{}) error {
 	// Clean up resources on shutdown.
 	defer s.Destory()
 
+	// once a new process took over the listeners, shut down like on stopCh.
+	if s.UpgradeSignal != nil {
+		stopCh = s.runUpgradeHandler(stopCh)
+	}
+
 	go func() {
 		defer delayedStopCh.Signal()
 
@@ -113,7 +167,27 @@ func (s preparedGenericAPIServer) Run(stopCh <-chan struct{}) error {
 		return err
 	}
 
+	// if this process was started by an upgrade, the old one shuts down once this one is ready.
+	go func() {
+		select {
+		case <-s.lifecycleSignals.PostStartHooksCompleted.Signaled():
+			if err := activation.NotifyReady(); err != nil {
+				fmt.Printf("Failed to notify the upgraded process: %v\n", err)
+			}
+		case <-stopCh:
+		}
+	}()
+
+	inFlightRequestsDrainedCh := s.lifecycleSignals.InFlightRequestsDrained
+	go func() {
+		<-stoppedCh
+		inFlightRequestsDrainedCh.Signal()
+	}()
+
 	httpServerStoppedListeningCh := s.lifecycleSignals.HTTPServerStoppedListening
+	// background health checks keep refreshing until the server stopped listening,
+	// so that /liveness stays green during graceful termination.
+	s.runBackgroundChecks(httpServerStoppedListeningCh.Signaled())
 	go func() {
 		<-listenerStoppedCh
 		httpServerStoppedListeningCh.Signal()
@@ -137,7 +211,11 @@ func (s preparedGenericAPIServer) Run(stopCh <-chan struct{}) error {
 	// run shutdown hooks directly.
 	func() {
 		defer preShutdownHooksHasStoppedCh.Signal()
+		err = s.RunPreShutdownHooks()
 	}()
+	if err != nil {
+		return err
+	}
 
 	// wait for stoppedCh that is closed when the graceful termination (server.Shutdown) is finished.
 	<-listenerStoppedCh
@@ -162,11 +240,15 @@ func (s preparedGenericAPIServer) NonBlockingRun(stopCh <-chan struct{}, shutdow
 	// Now that listener have bound successfully, it is the
 	// reponsiblity of the caller to close the provided channel to
 	// ensure cleanup.
+	stopCtx, cancel := context.WithCancel(context.Background())
 	go func() {
+		defer cancel()
 		<-stopCh
 		close(internalStopCh)
 	}()
 
+	s.RunPostStartHooks(stopCtx)
+
 	return stoppedCh, listenrerStoppedCh, nil
 }
 
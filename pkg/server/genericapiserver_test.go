@@ -0,0 +1,60 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRequestsInFlight(t *testing.T) {
+	tests := []struct {
+		name                        string
+		maxRequestsInFlight         int
+		maxMutatingRequestsInFlight int
+		wantNonMutating             int
+		wantMutating                int
+	}{
+		{name: "limited", maxRequestsInFlight: 10, maxMutatingRequestsInFlight: 10, wantNonMutating: 1, wantMutating: 1},
+		{name: "read-only limited", maxRequestsInFlight: 10, wantNonMutating: 1},
+		{name: "unlimited"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) {
+				c.MaxRequestsInFlight = tt.maxRequestsInFlight
+				c.MaxMutatingRequestsInFlight = tt.maxMutatingRequestsInFlight
+			})
+			entered, release := make(chan struct{}), make(chan struct{})
+			s.Handler.GoRestfulApp.All("/block", func(c *fiber.Ctx) error {
+				entered <- struct{}{}
+				<-release
+				return nil
+			})
+
+			done := make(chan struct{})
+			for _, method := range []string{http.MethodGet, http.MethodPost} {
+				go func(method string) {
+					defer func() { done <- struct{}{} }()
+					resp, err := s.Handler.GoRestfulApp.Test(httptest.NewRequest(method, "/block", nil), -1)
+					if err == nil {
+						resp.Body.Close()
+					}
+				}(method)
+				<-entered
+			}
+
+			nonMutating, mutating := s.RequestsInFlight()
+			if nonMutating != tt.wantNonMutating || mutating != tt.wantMutating {
+				t.Errorf("RequestsInFlight() = %d, %d, want %d, %d", nonMutating, mutating, tt.wantNonMutating, tt.wantMutating)
+			}
+			close(release)
+			<-done
+			<-done
+			if nonMutating, mutating := s.RequestsInFlight(); nonMutating != 0 || mutating != 0 {
+				t.Errorf("RequestsInFlight() after the requests = %d, %d, want 0, 0", nonMutating, mutating)
+			}
+		})
+	}
+}
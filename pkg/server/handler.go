@@ -4,6 +4,9 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+// healthPathPrefix is the path of the routes of NonGoRestfulMux.
+const healthPathPrefix = "/actuator/health"
+
 type APIServerHandler struct {
 	GoRestfulApp    *fiber.App
 	NonGoRestfulMux fiber.Router
@@ -14,6 +17,6 @@ func NewAPIServerHandler() *APIServerHandler {
 
 	return &APIServerHandler{
 		GoRestfulApp:    gorestfulApp,
-		NonGoRestfulMux: gorestfulApp.Group("/actuator/health"),
+		NonGoRestfulMux: gorestfulApp.Group(healthPathPrefix),
 	}
 }
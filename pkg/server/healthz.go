@@ -2,7 +2,9 @@ package server
 
 import (
 	"fmt"
+	"time"
 
+	"github.com/ForbiddenR/apiserver/pkg/server/dynamiccertificates"
 	"github.com/ForbiddenR/apiserver/pkg/server/healthz"
 	"github.com/valyala/fasthttp"
 )
@@ -22,19 +24,86 @@ func (s *GenericAPIServer) installReadyz() {
 	s.readyzLock.Lock()
 	defer s.readyzLock.Unlock()
 	s.readyzChecksInstalled = true
-	healthz.InstallReadyzHandler(s.Handler.NonGoRestfulMux, s.readyzChecks...)
+	options := s.healthOptions.HandlerOptions
+	options.FirstTimeHealthy = s.lifecycleSignals.HasBeenReady.Signal
+	healthz.InstallReadyzHandlerWithOptions(s.Handler.NonGoRestfulMux, options, s.readyzChecks...)
 }
 
 func (s *GenericAPIServer) addReadyzShutdownCheck(stopCh <-chan struct{}) error {
 	return s.AddReadyzChecks(shutdownCheck{stopCh})
 }
 
+// AddStartupChecks allows you to add a HealthzCheck to startup.
+func (s *GenericAPIServer) AddStartupChecks(checks ...healthz.HealthzChecker) error {
+	s.startupLock.Lock()
+	defer s.startupLock.Unlock()
+	if s.startupChecksInstalled {
+		return fmt.Errorf("unable to add because the startup endpoint has already been created")
+	}
+	s.startupChecks = append(s.startupChecks, checks...)
+	return nil
+}
+
+// installStartup creates the startup endpoint for this server. Every check
+// stays green once it succeeded.
+func (s *GenericAPIServer) installStartup() {
+	s.startupLock.Lock()
+	defer s.startupLock.Unlock()
+	s.startupChecksInstalled = true
+	for _, check := range s.startupChecks {
+		s.latchedStartupChecks = append(s.latchedStartupChecks, healthz.NewLatchedChecker(check))
+	}
+	healthz.InstallStartupHandlerWithOptions(s.Handler.NonGoRestfulMux, s.healthOptions.HandlerOptions, s.latchedStartupChecks...)
+}
+
 // installLivez creates the livez endpoint for this server.
 func (s *GenericAPIServer) installLivez() {
 	s.livezLock.Lock()
 	defer s.livezLock.Unlock()
 	s.livezChecksInstalled = true
-	healthz.InstallLivezHandler(s.Handler.NonGoRestfulMux, s.livezChecks...)
+	healthz.InstallLivezHandlerWithOptions(s.Handler.NonGoRestfulMux, s.healthOptions.HandlerOptions, s.livezChecks...)
+}
+
+// installActuatorHealth creates the aggregated /actuator/health endpoint
+// containing every livez, readyz and startup check.
+func (s *GenericAPIServer) installActuatorHealth() {
+	s.livezLock.Lock()
+	defer s.livezLock.Unlock()
+	s.readyzLock.Lock()
+	defer s.readyzLock.Unlock()
+	s.startupLock.Lock()
+	defer s.startupLock.Unlock()
+	healthz.InstallActuatorHandler(s.Handler.NonGoRestfulMux, s.healthOptions,
+		healthz.HealthzGroup{Name: "liveness", Checks: s.livezChecks},
+		healthz.HealthzGroup{Name: "readiness", Checks: s.readyzChecks},
+		healthz.HealthzGroup{Name: "startup", Checks: s.latchedStartupChecks},
+	)
+}
+
+// runBackgroundChecks starts every livez, readyz and startup check, including the children
+// of composite checks, which needs to run in the background until stopCh is closed.
+func (s *GenericAPIServer) runBackgroundChecks(stopCh <-chan struct{}) {
+	s.livezLock.Lock()
+	checks := append([]healthz.HealthzChecker{}, s.livezChecks...)
+	s.livezLock.Unlock()
+	s.readyzLock.Lock()
+	checks = append(checks, s.readyzChecks...)
+	s.readyzLock.Unlock()
+	s.startupLock.Lock()
+	checks = append(checks, s.startupChecks...)
+	s.startupLock.Unlock()
+
+	for len(checks) > 0 {
+		check := checks[0]
+		checks = checks[1:]
+		if composite, ok := check.(healthz.HealthzCompositeChecker); ok {
+			checks = append(checks, composite.Checks()...)
+			continue
+		}
+		if background, ok := check.(healthz.HealthzBackgroundChecker); ok {
+			go background.Run(stopCh)
+		}
+	}
 }
 
 type shutdownCheck struct {
@@ -48,8 +117,59 @@ func (shutdownCheck) Name() string {
 func (c shutdownCheck) Check(req *fasthttp.Request) error {
 	select {
 	case <-c.StopCh:
-		return fmt.Errorf("process is shutting down")
+		return fmt.Errorf("process is shutting down: %w", healthz.ErrOutOfService)
 	default:
 	}
 	return nil
 }
+
+type postStartHooksCheck struct {
+	CompletedCh <-chan struct{}
+	// Failure returns the errors of the post-start hooks which failed.
+	Failure func() error
+}
+
+func (postStartHooksCheck) Name() string {
+	return "poststarthooks"
+}
+
+func (c postStartHooksCheck) Check(req *fasthttp.Request) error {
+	select {
+	case <-c.CompletedCh:
+		return nil
+	default:
+	}
+	if err := c.Failure(); err != nil {
+		return err
+	}
+	return fmt.Errorf("not all post-start hooks have completed")
+}
+
+// servingCertCheck fails once the serving certificate expired. Its details
+// report when the certificate expires.
+type servingCertCheck struct {
+	Cert dynamiccertificates.CertProvider
+}
+
+func (servingCertCheck) Name() string {
+	return "servingcert"
+}
+
+func (c servingCertCheck) Check(req *fasthttp.Request) error {
+	leaf := c.Cert.CurrentCertificate().Leaf
+	if leaf != nil && time.Now().After(leaf.NotAfter) {
+		return fmt.Errorf("serving certificate expired at %s", leaf.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (c servingCertCheck) Details() map[string]interface{} {
+	leaf := c.Cert.CurrentCertificate().Leaf
+	if leaf == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"subject":  leaf.Subject.String(),
+		"notAfter": leaf.NotAfter.Format(time.RFC3339),
+	}
+}
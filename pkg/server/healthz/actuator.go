@@ -0,0 +1,276 @@
+package healthz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// The statuses understood by Spring Boot Actuator.
+const (
+	StatusUp           = "UP"
+	StatusDown         = "DOWN"
+	StatusOutOfService = "OUT_OF_SERVICE"
+	StatusUnknown      = "UNKNOWN"
+)
+
+// ErrOutOfService can be wrapped by the error of a check to report it as
+// OUT_OF_SERVICE instead of DOWN, e.g. while the server is shutting down.
+var ErrOutOfService = errors.New("out of service")
+
+// checkStatus maps the result of a check to its status.
+func checkStatus(err error) string {
+	switch {
+	case err == nil:
+		return StatusUp
+	case errors.Is(err, ErrOutOfService):
+		return StatusOutOfService
+	default:
+		return StatusDown
+	}
+}
+
+// statusOrder is the order in which statuses win when they are aggregated,
+// most severe first.
+var statusOrder = []string{StatusDown, StatusOutOfService, StatusUp, StatusUnknown}
+
+// AggregateStatus returns the most severe of the given statuses following the
+// ordering DOWN > OUT_OF_SERVICE > UP > UNKNOWN. Statuses not in that list are
+// ranked below UNKNOWN. It returns UNKNOWN if no status is given.
+func AggregateStatus(statuses ...string) string {
+	rank := func(status string) int {
+		for i, s := range statusOrder {
+			if s == status {
+				return i
+			}
+		}
+		return len(statusOrder)
+	}
+
+	aggregated := StatusUnknown
+	for _, status := range statuses {
+		if rank(status) < rank(aggregated) {
+			aggregated = status
+		}
+	}
+	return aggregated
+}
+
+// httpStatusCode maps a status to the response code used by Spring Boot Actuator.
+func httpStatusCode(status string) int {
+	switch status {
+	case StatusDown, StatusOutOfService:
+		return fasthttp.StatusServiceUnavailable
+	default:
+		return fasthttp.StatusOK
+	}
+}
+
+// ShowDetails controls whether the components and details of the health
+// document are rendered.
+type ShowDetails string
+
+const (
+	// ShowDetailsNever only renders the aggregated status.
+	ShowDetailsNever ShowDetails = "never"
+	// ShowDetailsAlways renders every component with its details.
+	ShowDetailsAlways ShowDetails = "always"
+	// ShowDetailsWhenAuthorized renders every component with its details if the
+	// request is authorized by ActuatorOptions.Authorized.
+	ShowDetailsWhenAuthorized ShowDetails = "when-authorized"
+)
+
+// HealthzDetailsProvider can be implemented by a HealthzChecker to contribute
+// details to its component of the health document.
+type HealthzDetailsProvider interface {
+	Details() map[string]interface{}
+}
+
+// HealthzCompositeChecker can be implemented by a HealthzChecker that groups
+// other checks. In the health document it is rendered as a nested component
+// whose status is the aggregation of its children.
+type HealthzCompositeChecker interface {
+	HealthzChecker
+	Checks() []HealthzChecker
+}
+
+// HealthzGroup is a named set of checks, e.g. liveness or readiness.
+type HealthzGroup struct {
+	Name   string
+	Checks []HealthzChecker
+}
+
+// ActuatorOptions configures the aggregated health document.
+type ActuatorOptions struct {
+	HandlerOptions
+	// ShowDetails controls whether components and details are rendered.
+	// Defaults to ShowDetailsNever.
+	ShowDetails ShowDetails
+	// Authorized decides whether a request may see the details when
+	// ShowDetails is ShowDetailsWhenAuthorized. If nil, no request is authorized.
+	Authorized func(ctx *fiber.Ctx) bool
+}
+
+func (o ActuatorOptions) showDetails(ctx *fiber.Ctx) bool {
+	switch o.ShowDetails {
+	case ShowDetailsAlways:
+		return true
+	case ShowDetailsWhenAuthorized:
+		return o.Authorized != nil && o.Authorized(ctx)
+	default:
+		return false
+	}
+}
+
+// ActuatorHealthResponse is the Spring Boot Actuator compatible health document.
+type ActuatorHealthResponse struct {
+	Status     string                      `json:"status"`
+	Components map[string]*HealthComponent `json:"components,omitempty"`
+	Groups     []string                    `json:"groups,omitempty"`
+}
+
+// HealthComponent is the status of a single check or of a group of checks.
+type HealthComponent struct {
+	Status     string                      `json:"status"`
+	Details    map[string]interface{}      `json:"details,omitempty"`
+	Components map[string]*HealthComponent `json:"components,omitempty"`
+}
+
+// InstallActuatorHandler registers the aggregated health document on the root
+// path of mux. Its components contain every check of the given groups once.
+func InstallActuatorHandler(mux mux, options ActuatorOptions, groups ...HealthzGroup) {
+	var checks []HealthzChecker
+	var groupNames []string
+	seen := make(map[string]struct{})
+	for _, group := range groups {
+		groupNames = append(groupNames, group.Name)
+		for _, check := range group.Checks {
+			if _, ok := seen[check.Name()]; ok {
+				continue
+			}
+			seen[check.Name()] = struct{}{}
+			checks = append(checks, check)
+		}
+	}
+	sort.Strings(groupNames)
+
+	mux.Add(fiber.MethodGet, "/", handleActuatorHealth(options, groupNames, checks...))
+}
+
+func handleActuatorHealth(options ActuatorOptions, groups []string, checks ...HealthzChecker) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		checkCtx, cancel := options.context()
+		defer cancel()
+		components := options.checkComponents(checkCtx, ctx.Request(), checks...)
+
+		statuses := make([]string, 0, len(components))
+		for _, component := range components {
+			statuses = append(statuses, component.Status)
+		}
+		response := &ActuatorHealthResponse{
+			Status: AggregateStatus(statuses...),
+		}
+		if len(components) == 0 {
+			response.Status = StatusUp
+		}
+		if options.showDetails(ctx) {
+			response.Components = components
+			response.Groups = groups
+		}
+		return ctx.Status(httpStatusCode(response.Status)).JSON(response)
+	}
+}
+
+// checkComponents runs all checks concurrently, including the children of
+// composite checks, and returns the component of each one keyed by its name.
+func (o HandlerOptions) checkComponents(ctx context.Context, req *fasthttp.Request, checks ...HealthzChecker) map[string]*HealthComponent {
+	components := make(map[string]*HealthComponent, len(checks))
+	var leafChecks []HealthzChecker
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		composite, ok := check.(HealthzCompositeChecker)
+		if !ok {
+			leafChecks = append(leafChecks, check)
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			component := &HealthComponent{
+				Status:     StatusUp,
+				Components: o.checkComponents(ctx, req, composite.Checks()...),
+			}
+			if len(component.Components) > 0 {
+				statuses := make([]string, 0, len(component.Components))
+				for _, child := range component.Components {
+					statuses = append(statuses, child.Status)
+				}
+				component.Status = AggregateStatus(statuses...)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			components[composite.Name()] = component
+		}()
+	}
+
+	errs := o.runConcurrently(ctx, req, leafChecks...)
+	wg.Wait()
+	for i, check := range leafChecks {
+		components[check.Name()] = checkComponent(check, errs[i])
+	}
+	return components
+}
+
+func checkComponent(check HealthzChecker, err error) *HealthComponent {
+	component := &HealthComponent{}
+	if provider, ok := check.(HealthzDetailsProvider); ok {
+		if details := provider.Details(); len(details) > 0 {
+			component.Details = make(map[string]interface{}, len(details)+1)
+			for k, v := range details {
+				component.Details[k] = v
+			}
+		}
+	}
+	component.Status = checkStatus(err)
+	if err != nil {
+		if component.Details == nil {
+			component.Details = map[string]interface{}{}
+		}
+		component.Details["error"] = err.Error()
+	}
+	return component
+}
+
+// NewCompositeChecker returns a HealthzCompositeChecker named name which is
+// healthy when all of checks are healthy.
+func NewCompositeChecker(name string, checks ...HealthzChecker) HealthzCompositeChecker {
+	return &compositeChecker{name: name, checks: checks}
+}
+
+type compositeChecker struct {
+	name   string
+	checks []HealthzChecker
+}
+
+func (c *compositeChecker) Name() string {
+	return c.name
+}
+
+func (c *compositeChecker) Check(req *fasthttp.Request) error {
+	for _, check := range c.checks {
+		if err := check.Check(req); err != nil {
+			return fmt.Errorf("%s: %w", check.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (c *compositeChecker) Checks() []HealthzChecker {
+	return c.checks
+}
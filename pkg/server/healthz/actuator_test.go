@@ -0,0 +1,181 @@
+package healthz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAggregateStatus(t *testing.T) {
+	tests := []struct {
+		statuses []string
+		want     string
+	}{
+		{statuses: nil, want: StatusUnknown},
+		{statuses: []string{StatusUnknown}, want: StatusUnknown},
+		{statuses: []string{StatusUp, StatusUnknown}, want: StatusUp},
+		{statuses: []string{StatusUp, StatusOutOfService, StatusUnknown}, want: StatusOutOfService},
+		{statuses: []string{StatusOutOfService, StatusDown, StatusUp}, want: StatusDown},
+		{statuses: []string{"CUSTOM", StatusUp}, want: StatusUp},
+		{statuses: []string{"CUSTOM"}, want: StatusUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.statuses), func(t *testing.T) {
+			if got := AggregateStatus(tt.statuses...); got != tt.want {
+				t.Errorf("AggregateStatus(%v) = %q, want %q", tt.statuses, got, tt.want)
+			}
+		})
+	}
+}
+
+type detailedCheck struct {
+	fakeCheck
+	details map[string]interface{}
+}
+
+func (c detailedCheck) Details() map[string]interface{} {
+	return c.details
+}
+
+func TestActuatorHealth(t *testing.T) {
+	outOfService := fmt.Errorf("shutting down: %w", ErrOutOfService)
+
+	tests := []struct {
+		name     string
+		options  ActuatorOptions
+		groups   []HealthzGroup
+		wantCode int
+		want     ActuatorHealthResponse
+	}{
+		{
+			name:     "no checks",
+			wantCode: fiber.StatusOK,
+			want:     ActuatorHealthResponse{Status: StatusUp},
+		},
+		{
+			name: "up",
+			groups: []HealthzGroup{
+				{Name: "liveness", Checks: []HealthzChecker{fakeCheck{name: "a"}}},
+				{Name: "readiness", Checks: []HealthzChecker{fakeCheck{name: "a"}, fakeCheck{name: "b"}}},
+			},
+			wantCode: fiber.StatusOK,
+			want:     ActuatorHealthResponse{Status: StatusUp},
+		},
+		{
+			name: "down",
+			groups: []HealthzGroup{
+				{Name: "liveness", Checks: []HealthzChecker{fakeCheck{name: "a", err: errors.New("boom")}}},
+				{Name: "readiness", Checks: []HealthzChecker{fakeCheck{name: "b", err: outOfService}}},
+			},
+			wantCode: fiber.StatusServiceUnavailable,
+			want:     ActuatorHealthResponse{Status: StatusDown},
+		},
+		{
+			name: "out of service",
+			groups: []HealthzGroup{
+				{Name: "liveness", Checks: []HealthzChecker{fakeCheck{name: "a"}}},
+				{Name: "readiness", Checks: []HealthzChecker{fakeCheck{name: "b", err: outOfService}}},
+			},
+			wantCode: fiber.StatusServiceUnavailable,
+			want:     ActuatorHealthResponse{Status: StatusOutOfService},
+		},
+		{
+			name:    "show details",
+			options: ActuatorOptions{ShowDetails: ShowDetailsAlways},
+			groups: []HealthzGroup{
+				{Name: "readiness", Checks: []HealthzChecker{
+					detailedCheck{fakeCheck: fakeCheck{name: "a"}, details: map[string]interface{}{"version": "1"}},
+					fakeCheck{name: "b", err: outOfService},
+				}},
+				{Name: "liveness", Checks: []HealthzChecker{
+					NewCompositeChecker("db", fakeCheck{name: "primary"}, fakeCheck{name: "replica", err: errors.New("boom")}),
+				}},
+			},
+			wantCode: fiber.StatusServiceUnavailable,
+			want: ActuatorHealthResponse{
+				Status: StatusDown,
+				Components: map[string]*HealthComponent{
+					"a": {Status: StatusUp, Details: map[string]interface{}{"version": "1"}},
+					"b": {Status: StatusOutOfService, Details: map[string]interface{}{"error": "shutting down: out of service"}},
+					"db": {Status: StatusDown, Components: map[string]*HealthComponent{
+						"primary": {Status: StatusUp},
+						"replica": {Status: StatusDown, Details: map[string]interface{}{"error": "boom"}},
+					}},
+				},
+				Groups: []string{"liveness", "readiness"},
+			},
+		},
+		{
+			name:    "details when authorized",
+			options: ActuatorOptions{ShowDetails: ShowDetailsWhenAuthorized, Authorized: func(ctx *fiber.Ctx) bool { return true }},
+			groups: []HealthzGroup{
+				{Name: "readiness", Checks: []HealthzChecker{fakeCheck{name: "a"}}},
+			},
+			wantCode: fiber.StatusOK,
+			want: ActuatorHealthResponse{
+				Status:     StatusUp,
+				Components: map[string]*HealthComponent{"a": {Status: StatusUp}},
+				Groups:     []string{"readiness"},
+			},
+		},
+		{
+			name:    "details when not authorized",
+			options: ActuatorOptions{ShowDetails: ShowDetailsWhenAuthorized, Authorized: func(ctx *fiber.Ctx) bool { return false }},
+			groups: []HealthzGroup{
+				{Name: "readiness", Checks: []HealthzChecker{fakeCheck{name: "a"}}},
+			},
+			wantCode: fiber.StatusOK,
+			want:     ActuatorHealthResponse{Status: StatusUp},
+		},
+		{
+			name:    "details without authorizer",
+			options: ActuatorOptions{ShowDetails: ShowDetailsWhenAuthorized},
+			groups: []HealthzGroup{
+				{Name: "readiness", Checks: []HealthzChecker{fakeCheck{name: "a"}}},
+			},
+			wantCode: fiber.StatusOK,
+			want:     ActuatorHealthResponse{Status: StatusUp},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			InstallActuatorHandler(app, tt.options, tt.groups...)
+
+			code, body := get(t, app, "/")
+			if code != tt.wantCode {
+				t.Errorf("status code = %d, want %d", code, tt.wantCode)
+			}
+			var got ActuatorHealthResponse
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("invalid body %q: %v", body, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(tt.want)
+				t.Errorf("response = %s, want %s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestCheckHealthOutOfService(t *testing.T) {
+	app := fiber.New()
+	InstallReadyzHandler(app, fakeCheck{name: "shutdown", err: fmt.Errorf("shutting down: %w", ErrOutOfService)})
+
+	code, body := get(t, app, "/readiness/shutdown")
+	if code != fiber.StatusNotFound {
+		t.Errorf("status code = %d, want %d", code, fiber.StatusNotFound)
+	}
+	var got ComponentResponse
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("invalid body %q: %v", body, err)
+	}
+	if got.Status != StatusOutOfService {
+		t.Errorf("status = %q, want %q", got.Status, StatusOutOfService)
+	}
+}
@@ -0,0 +1,118 @@
+package healthz
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// HealthzBackgroundChecker is a HealthzChecker which does its work in the
+// background. Run blocks until stopCh is closed, the server calls it once
+// it starts serving and closes stopCh once it stopped listening.
+type HealthzBackgroundChecker interface {
+	HealthzChecker
+	Run(stopCh <-chan struct{})
+}
+
+var _ HealthzBackgroundChecker = &CachedChecker{}
+var _ HealthzDetailsProvider = &CachedChecker{}
+
+// CachedChecker runs a HealthzChecker on an interval in the background and
+// serves probes from the result of the last run.
+type CachedChecker struct {
+	check      HealthzChecker
+	interval   time.Duration
+	staleAfter time.Duration
+
+	runOnce sync.Once
+
+	lock        sync.RWMutex
+	lastErr     error
+	lastChecked time.Time
+}
+
+// NewCachedChecker returns a CachedChecker which runs check every interval.
+// Every run is bounded by interval. If the cached result hasn't been refreshed
+// for staleAfter it is reported as failed, zero disables the staleness detection.
+// Otherwise staleAfter must be greater than interval.
+func NewCachedChecker(check HealthzChecker, interval, staleAfter time.Duration) (*CachedChecker, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval of cached check %q must be greater than zero, got %v", check.Name(), interval)
+	}
+	if staleAfter < 0 || (staleAfter > 0 && staleAfter <= interval) {
+		return nil, fmt.Errorf("staleAfter of cached check %q must be zero or greater than the interval %v, got %v", check.Name(), interval, staleAfter)
+	}
+	return &CachedChecker{
+		check:      check,
+		interval:   interval,
+		staleAfter: staleAfter,
+	}, nil
+}
+
+func (c *CachedChecker) Name() string {
+	return c.check.Name()
+}
+
+// Check returns the cached result. It never runs the underlying check.
+func (c *CachedChecker) Check(req *fasthttp.Request) error {
+	lastChecked, lastErr := c.LastResult()
+	if lastChecked.IsZero() {
+		return fmt.Errorf("not checked yet")
+	}
+	if c.staleAfter > 0 {
+		if age := time.Since(lastChecked); age > c.staleAfter {
+			return fmt.Errorf("last result is stale, it was refreshed %v ago", age.Round(time.Millisecond))
+		}
+	}
+	return lastErr
+}
+
+// Details reports when the cached result was refreshed.
+func (c *CachedChecker) Details() map[string]interface{} {
+	lastChecked, _ := c.LastResult()
+	if lastChecked.IsZero() {
+		return nil
+	}
+	return map[string]interface{}{"lastChecked": lastChecked.Format(time.RFC3339Nano)}
+}
+
+// LastResult returns when the last run finished and its error. The time is
+// zero if the check hasn't run yet.
+func (c *CachedChecker) LastResult() (time.Time, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.lastChecked, c.lastErr
+}
+
+// Run runs the check immediately and then every interval until stopCh is closed.
+// Only the first call to Run has an effect.
+func (c *CachedChecker) Run(stopCh <-chan struct{}) {
+	c.runOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-stopCh
+			cancel()
+		}()
+
+		options := HandlerOptions{CheckTimeout: c.interval}
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		for {
+			err := options.runCheck(ctx, &fasthttp.Request{}, c.check)
+
+			c.lock.Lock()
+			c.lastErr, c.lastChecked = err, time.Now()
+			c.lock.Unlock()
+
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
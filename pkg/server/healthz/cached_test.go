@@ -0,0 +1,140 @@
+package healthz
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// countingCheck counts its runs and returns err.
+type countingCheck struct {
+	runs atomic.Int32
+	err  atomic.Pointer[error]
+}
+
+func (c *countingCheck) Name() string {
+	return "counting"
+}
+
+func (c *countingCheck) Check(req *fasthttp.Request) error {
+	c.runs.Add(1)
+	if err := c.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func (c *countingCheck) setErr(err error) {
+	c.err.Store(&err)
+}
+
+func TestNewCachedChecker(t *testing.T) {
+	tests := []struct {
+		name       string
+		interval   time.Duration
+		staleAfter time.Duration
+		wantErr    bool
+	}{
+		{name: "without staleness", interval: time.Second},
+		{name: "with staleness", interval: time.Second, staleAfter: 3 * time.Second},
+		{name: "zero interval", interval: 0, wantErr: true},
+		{name: "negative interval", interval: -time.Second, wantErr: true},
+		{name: "negative staleness", interval: time.Second, staleAfter: -time.Second, wantErr: true},
+		{name: "staleness equal to interval", interval: time.Second, staleAfter: time.Second, wantErr: true},
+		{name: "staleness below interval", interval: time.Second, staleAfter: time.Millisecond, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewCachedChecker(&countingCheck{}, tt.interval, tt.staleAfter)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewCachedChecker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// waitFor polls condition until it is true or fails the test after a second.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCachedChecker(t *testing.T) {
+	check := &countingCheck{}
+	cached, err := NewCachedChecker(check, 20*time.Millisecond, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cached.Check(nil); err == nil || err.Error() != "not checked yet" {
+		t.Errorf("Check() before the first run = %v, want not checked yet", err)
+	}
+	if details := cached.Details(); details != nil {
+		t.Errorf("Details() before the first run = %v, want nil", details)
+	}
+	if cached.Name() != check.Name() {
+		t.Errorf("Name() = %q, want %q", cached.Name(), check.Name())
+	}
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	go cached.Run(stopCh)
+	waitFor(t, func() bool { return cached.Check(nil) == nil })
+	if _, ok := cached.Details()["lastChecked"]; !ok {
+		t.Errorf("Details() = %v, want lastChecked", cached.Details())
+	}
+
+	// probes are served from the cache.
+	runs := check.runs.Load()
+	for i := 0; i < 10; i++ {
+		cached.Check(nil)
+	}
+	if got := check.runs.Load(); got > runs+1 {
+		t.Errorf("the check ran %d times during the probes, want it to run in the background only", got-runs)
+	}
+
+	check.setErr(errors.New("boom"))
+	waitFor(t, func() bool {
+		err := cached.Check(nil)
+		return err != nil && err.Error() == "boom"
+	})
+	check.setErr(nil)
+	waitFor(t, func() bool { return cached.Check(nil) == nil })
+}
+
+func TestCachedCheckerStaleness(t *testing.T) {
+	cached, err := NewCachedChecker(&countingCheck{}, 20*time.Millisecond, 60*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cached.Run(stopCh)
+	}()
+	waitFor(t, func() bool { return cached.Check(nil) == nil })
+
+	// the result stays fresh while the check is running.
+	time.Sleep(100 * time.Millisecond)
+	if err := cached.Check(nil); err != nil {
+		t.Errorf("Check() while running = %v, want nil", err)
+	}
+
+	close(stopCh)
+	<-done
+	waitFor(t, func() bool {
+		err := cached.Check(nil)
+		return err != nil && strings.Contains(err.Error(), "stale")
+	})
+}
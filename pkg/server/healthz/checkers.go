@@ -0,0 +1,171 @@
+package healthz
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// defaultCheckTimeout bounds the checkers of this file which do I/O when
+// neither the checker nor the caller set a deadline.
+const defaultCheckTimeout = 5 * time.Second
+
+// NewFuncChecker returns a HealthzContextChecker named name which runs fn.
+func NewFuncChecker(name string, fn func(ctx context.Context) error) HealthzContextChecker {
+	return &funcChecker{name: name, fn: fn}
+}
+
+type funcChecker struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+func (c *funcChecker) Name() string {
+	return c.name
+}
+
+func (c *funcChecker) Check(req *fasthttp.Request) error {
+	return c.fn(context.Background())
+}
+
+func (c *funcChecker) CheckContext(ctx context.Context, req *fasthttp.Request) error {
+	return c.fn(ctx)
+}
+
+// withDefaultTimeout bounds ctx by timeout, or by defaultCheckTimeout if timeout
+// is zero, unless ctx already has a deadline.
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, defaultCheckTimeout)
+}
+
+// NewTCPChecker returns a checker which is healthy if a TCP connection to
+// address can be established within timeout.
+func NewTCPChecker(name, address string, timeout time.Duration) HealthzContextChecker {
+	return NewFuncChecker(name, func(ctx context.Context) error {
+		ctx, cancel := withDefaultTimeout(ctx, timeout)
+		defer cancel()
+
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	})
+}
+
+// NewHTTPGetChecker returns a checker which is healthy if a GET request to url
+// responds with expectedStatusCode within timeout.
+func NewHTTPGetChecker(name, url string, expectedStatusCode int, timeout time.Duration) HealthzContextChecker {
+	return NewFuncChecker(name, func(ctx context.Context) error {
+		ctx, cancel := withDefaultTimeout(ctx, timeout)
+		defer cancel()
+		deadline, _ := ctx.Deadline()
+
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+
+		req.SetRequestURI(url)
+		req.Header.SetMethod(fasthttp.MethodGet)
+		if err := fasthttp.DoDeadline(req, resp, deadline); err != nil {
+			return err
+		}
+		if resp.StatusCode() != expectedStatusCode {
+			return fmt.Errorf("GET %s returned status code %d, expected %d", url, resp.StatusCode(), expectedStatusCode)
+		}
+		return nil
+	})
+}
+
+// NewDNSChecker returns a checker which is healthy if host resolves to at least
+// one address within timeout.
+func NewDNSChecker(name, host string, timeout time.Duration) HealthzContextChecker {
+	return NewFuncChecker(name, func(ctx context.Context) error {
+		ctx, cancel := withDefaultTimeout(ctx, timeout)
+		defer cancel()
+
+		addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+		if err != nil {
+			return err
+		}
+		if len(addrs) == 0 {
+			return fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil
+	})
+}
+
+// NewDiskSpaceChecker returns a checker which is healthy if the file system
+// containing path has at least minFreeBytes available.
+func NewDiskSpaceChecker(name, path string, minFreeBytes uint64) HealthzContextChecker {
+	return NewFuncChecker(name, func(ctx context.Context) error {
+		free, err := freeDiskSpace(path)
+		if err != nil {
+			return err
+		}
+		if free < minFreeBytes {
+			return fmt.Errorf("%d bytes available on %s, expected at least %d", free, path, minFreeBytes)
+		}
+		return nil
+	})
+}
+
+// NewFileChecker returns a checker which is healthy if path exists.
+func NewFileChecker(name, path string) HealthzContextChecker {
+	return NewFuncChecker(name, func(ctx context.Context) error {
+		_, err := os.Stat(path)
+		return err
+	})
+}
+
+// NewUnixSocketChecker returns a checker which is healthy if path exists and
+// is a unix domain socket.
+func NewUnixSocketChecker(name, path string) HealthzContextChecker {
+	return NewFuncChecker(name, func(ctx context.Context) error {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("%s is not a socket", path)
+		}
+		return nil
+	})
+}
+
+// NewGoroutineChecker returns a checker which is healthy as long as the number
+// of goroutines doesn't exceed max.
+func NewGoroutineChecker(name string, max int) HealthzContextChecker {
+	return NewFuncChecker(name, func(ctx context.Context) error {
+		if n := runtime.NumGoroutine(); n > max {
+			return fmt.Errorf("%d goroutines, expected at most %d", n, max)
+		}
+		return nil
+	})
+}
+
+// NewHeapChecker returns a checker which is healthy as long as the allocated
+// heap doesn't exceed maxBytes.
+func NewHeapChecker(name string, maxBytes uint64) HealthzContextChecker {
+	return NewFuncChecker(name, func(ctx context.Context) error {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		if stats.HeapAlloc > maxBytes {
+			return fmt.Errorf("%d bytes of heap allocated, expected at most %d", stats.HeapAlloc, maxBytes)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,277 @@
+package healthz
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+type checkerTestCase struct {
+	name    string
+	checker HealthzContextChecker
+	// ctx defaults to context.Background.
+	ctx     context.Context
+	wantErr bool
+}
+
+func runCheckerTests(t *testing.T, tests []checkerTestCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.checker.Name(); got != tt.name {
+				t.Errorf("Name() = %q, want %q", got, tt.name)
+			}
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			err := tt.checker.CheckContext(ctx, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFuncChecker(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+
+	runCheckerTests(t, []checkerTestCase{
+		{
+			name:    "func-pass",
+			checker: NewFuncChecker("func-pass", func(ctx context.Context) error { return nil }),
+		},
+		{
+			name:    "func-fail",
+			checker: NewFuncChecker("func-fail", func(ctx context.Context) error { return errors.New("failed") }),
+			wantErr: true,
+		},
+		{
+			name: "func-timeout",
+			checker: NewFuncChecker("func-timeout", func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}),
+			ctx:     expired,
+			wantErr: true,
+		},
+	})
+}
+
+func TestTCPChecker(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddress := closed.Addr().String()
+	closed.Close()
+
+	runCheckerTests(t, []checkerTestCase{
+		{
+			name:    "tcp-pass",
+			checker: NewTCPChecker("tcp-pass", listener.Addr().String(), time.Second),
+		},
+		{
+			name:    "tcp-fail",
+			checker: NewTCPChecker("tcp-fail", closedAddress, time.Second),
+			wantErr: true,
+		},
+		{
+			name:    "tcp-timeout",
+			checker: NewTCPChecker("tcp-timeout", listener.Addr().String(), time.Nanosecond),
+			wantErr: true,
+		},
+	})
+}
+
+func TestHTTPGetChecker(t *testing.T) {
+	stopCh := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			select {
+			case <-stopCh:
+			case <-time.After(5 * time.Second):
+			}
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	defer close(stopCh)
+
+	runCheckerTests(t, []checkerTestCase{
+		{
+			name:    "http-pass",
+			checker: NewHTTPGetChecker("http-pass", server.URL+"/", http.StatusOK, time.Second),
+		},
+		{
+			name:    "http-fail",
+			checker: NewHTTPGetChecker("http-fail", server.URL+"/missing", http.StatusOK, time.Second),
+			wantErr: true,
+		},
+		{
+			name:    "http-timeout",
+			checker: NewHTTPGetChecker("http-timeout", server.URL+"/slow", http.StatusOK, 50*time.Millisecond),
+			wantErr: true,
+		},
+	})
+}
+
+func TestDNSChecker(t *testing.T) {
+	runCheckerTests(t, []checkerTestCase{
+		{
+			name:    "dns-pass",
+			checker: NewDNSChecker("dns-pass", "localhost", time.Second),
+		},
+		{
+			name:    "dns-fail",
+			checker: NewDNSChecker("dns-fail", "does-not-exist.invalid", time.Second),
+			wantErr: true,
+		},
+		{
+			name:    "dns-timeout",
+			checker: NewDNSChecker("dns-timeout", "does-not-exist.invalid", time.Nanosecond),
+			wantErr: true,
+		},
+	})
+}
+
+func TestDiskSpaceChecker(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux", "darwin", "freebsd":
+	default:
+		t.Skipf("disk space check is not supported on %s", runtime.GOOS)
+	}
+	dir := t.TempDir()
+
+	runCheckerTests(t, []checkerTestCase{
+		{
+			name:    "disk-pass",
+			checker: NewDiskSpaceChecker("disk-pass", dir, 1),
+		},
+		{
+			name:    "disk-fail",
+			checker: NewDiskSpaceChecker("disk-fail", dir, math.MaxUint64),
+			wantErr: true,
+		},
+		{
+			name:    "disk-missing",
+			checker: NewDiskSpaceChecker("disk-missing", filepath.Join(dir, "missing"), 1),
+			wantErr: true,
+		},
+	})
+}
+
+func TestFileChecker(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	runCheckerTests(t, []checkerTestCase{
+		{
+			name:    "file-pass",
+			checker: NewFileChecker("file-pass", file),
+		},
+		{
+			name:    "file-fail",
+			checker: NewFileChecker("file-fail", filepath.Join(dir, "missing")),
+			wantErr: true,
+		},
+	})
+}
+
+func TestUnixSocketChecker(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets are not supported on windows")
+	}
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "socket")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	runCheckerTests(t, []checkerTestCase{
+		{
+			name:    "socket-pass",
+			checker: NewUnixSocketChecker("socket-pass", socket),
+		},
+		{
+			name:    "socket-fail",
+			checker: NewUnixSocketChecker("socket-fail", file),
+			wantErr: true,
+		},
+		{
+			name:    "socket-missing",
+			checker: NewUnixSocketChecker("socket-missing", filepath.Join(dir, "missing")),
+			wantErr: true,
+		},
+	})
+}
+
+func TestGoroutineChecker(t *testing.T) {
+	runCheckerTests(t, []checkerTestCase{
+		{
+			name:    "goroutines-pass",
+			checker: NewGoroutineChecker("goroutines-pass", math.MaxInt32),
+		},
+		{
+			name:    "goroutines-fail",
+			checker: NewGoroutineChecker("goroutines-fail", 0),
+			wantErr: true,
+		},
+	})
+}
+
+func TestHeapChecker(t *testing.T) {
+	runCheckerTests(t, []checkerTestCase{
+		{
+			name:    "heap-pass",
+			checker: NewHeapChecker("heap-pass", math.MaxUint64),
+		},
+		{
+			name:    "heap-fail",
+			checker: NewHeapChecker("heap-fail", 0),
+			wantErr: true,
+		},
+	})
+}
+
+// TestCheckTimeout verifies that a checker which ignores its context is still
+// bounded by the timeout of the handler options.
+func TestCheckTimeout(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	checker := NewFuncChecker("blocking", func(ctx context.Context) error {
+		<-stopCh
+		return nil
+	})
+
+	options := HandlerOptions{CheckTimeout: 10 * time.Millisecond}
+	if err := options.runCheck(context.Background(), nil, checker); err == nil {
+		t.Errorf("expected the check to time out")
+	}
+}
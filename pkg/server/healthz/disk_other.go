@@ -0,0 +1,12 @@
+//go:build !(linux || darwin || freebsd)
+
+package healthz
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func freeDiskSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("disk space check is not supported on %s", runtime.GOOS)
+}
@@ -1,7 +1,11 @@
 package healthz
 
 import (
+	"bytes"
+	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/valyala/fasthttp"
@@ -49,7 +53,13 @@ func InstallHandler(mux mux, checks ...HealthzChecker) {
 // exactly one call to InstallReadyzHandler. Calling InstallReadyzHandler more
 // than once for the same path and mux will result in a panic.
 func InstallReadyzHandler(mux mux, checks ...HealthzChecker) {
-	InstallPathHandler(mux, "/readiness", checks...)
+	InstallReadyzHandlerWithOptions(mux, HandlerOptions{}, checks...)
+}
+
+// InstallReadyzHandlerWithOptions is like InstallReadyzHandler, but runs the
+// checks as configured by options.
+func InstallReadyzHandlerWithOptions(mux mux, options HandlerOptions, checks ...HealthzChecker) {
+	InstallPathHandlerWithOptions(mux, "/readiness", options, checks...)
 }
 
 // InstallLivezHandler registers handlers for health checking on the path
@@ -57,7 +67,27 @@ func InstallReadyzHandler(mux mux, checks ...HealthzChecker) {
 // exactly one call to InstallLivezHandler. Calling InstallLivezHandler more
 // than once for the same path and mux will result in a panic.
 func InstallLivezHandler(mux mux, checks ...HealthzChecker) {
-	InstallPathHandler(mux, "/liveness", checks...)
+	InstallLivezHandlerWithOptions(mux, HandlerOptions{}, checks...)
+}
+
+// InstallLivezHandlerWithOptions is like InstallLivezHandler, but runs the
+// checks as configured by options.
+func InstallLivezHandlerWithOptions(mux mux, options HandlerOptions, checks ...HealthzChecker) {
+	InstallPathHandlerWithOptions(mux, "/liveness", options, checks...)
+}
+
+// InstallStartupHandler registers handlers for health checking on the path
+// "/startup" to mux. *All handlers* for the path must be specified in
+// exactly one call to InstallStartupHandler. Calling InstallStartupHandler more
+// than once for the same path and mux will result in a panic.
+func InstallStartupHandler(mux mux, checks ...HealthzChecker) {
+	InstallStartupHandlerWithOptions(mux, HandlerOptions{}, checks...)
+}
+
+// InstallStartupHandlerWithOptions is like InstallStartupHandler, but runs the
+// checks as configured by options.
+func InstallStartupHandlerWithOptions(mux mux, options HandlerOptions, checks ...HealthzChecker) {
+	InstallPathHandlerWithOptions(mux, "/startup", options, checks...)
 }
 
 // InstallPathHandler registers handlers for health checking on
@@ -65,13 +95,32 @@ func InstallLivezHandler(mux mux, checks ...HealthzChecker) {
 // specified in exactly one call to InstallPathHandler. Calling
 // InstallPathHandler more than once for the same path and mux will
 // result in a panic.
+// In addition to the root path, a sub path is registered for every
+// check, e.g. "/readiness/database", which runs only that check.
 func InstallPathHandler(mux mux, path string, checks ...HealthzChecker) {
-	InstallPathHandlerWithHealthyFunc(mux, path, checks...)
+	InstallPathHandlerWithHealthyFunc(mux, path, nil, checks...)
 }
 
-func InstallPathHandlerWithHealthyFunc(mux mux, path string, checks ...HealthzChecker) {
+// InstallPathHandlerWithHealthyFunc is like InstallPathHandler, but calls firstTimeHealthy exactly once
+// when the handler succeeds for the first time.
+func InstallPathHandlerWithHealthyFunc(mux mux, path string, firstTimeHealthy func(), checks ...HealthzChecker) {
+	InstallPathHandlerWithOptions(mux, path, HandlerOptions{FirstTimeHealthy: firstTimeHealthy}, checks...)
+}
+
+// InstallPathHandlerWithOptions is like InstallPathHandler, but runs the
+// checks as configured by options.
+func InstallPathHandlerWithOptions(mux mux, path string, options HandlerOptions, checks ...HealthzChecker) {
 	name := strings.Split(strings.TrimPrefix(path, "/"), "/")[0]
-	mux.Add(fiber.MethodGet, path, handleRootHealth(name, checks...))
+	mux.Add(fiber.MethodGet, path, handleRootHealth(name, options, checks...))
+
+	installed := make(map[string]struct{}, len(checks))
+	for _, check := range checks {
+		if _, ok := installed[check.Name()]; ok {
+			continue
+		}
+		installed[check.Name()] = struct{}{}
+		mux.Add(fiber.MethodGet, fmt.Sprintf("%s/%s", path, check.Name()), handleCheckHealth(options, check))
+	}
 }
 
 // mux is a interface describing the methods InstallHandler requires.
@@ -79,16 +128,160 @@ type mux interface {
 	Add(verb string, pattern string, handlers ...fiber.Handler) fiber.Router
 }
 
-func handleRootHealth(name string, checks ...HealthzChecker) fiber.Handler {
+func handleRootHealth(name string, options HandlerOptions, checks ...HealthzChecker) fiber.Handler {
+	var notifyOnce sync.Once
+	return func(ctx *fiber.Ctx) error {
+		results, warnings := runChecks(ctx.Request(), options, getExcludedChecks(ctx), checks...)
+
+		failed := false
+		for _, result := range results {
+			if result.Status == CheckStatusFailed {
+				failed = true
+				break
+			}
+		}
+		if !failed && options.FirstTimeHealthy != nil {
+			notifyOnce.Do(options.FirstTimeHealthy)
+		}
+
+		statusCode := fasthttp.StatusOK
+		if failed {
+			statusCode = fasthttp.StatusNotFound
+		}
+
+		if !ctx.Context().QueryArgs().Has("verbose") {
+			code := 0
+			if failed {
+				code = 1
+			}
+			return ctx.Status(statusCode).JSON(GetHealthzResponse(name, code))
+		}
+
+		if ctx.Query("format") == "json" {
+			status := "ok"
+			if failed {
+				status = "failed"
+			}
+			return ctx.Status(statusCode).JSON(&VerboseHealthzResponse{
+				Name:     name,
+				Status:   status,
+				Checks:   results,
+				Warnings: warnings,
+			})
+		}
+
+		var individualCheckOutput bytes.Buffer
+		for _, result := range results {
+			switch result.Status {
+			case CheckStatusOK:
+				fmt.Fprintf(&individualCheckOutput, "[+]%s ok\n", result.Name)
+			case CheckStatusExcluded:
+				fmt.Fprintf(&individualCheckOutput, "[+]%s excluded: ok\n", result.Name)
+			default:
+				fmt.Fprintf(&individualCheckOutput, "[-]%s failed: %s\n", result.Name, result.Reason)
+			}
+		}
+		for _, warning := range warnings {
+			fmt.Fprintf(&individualCheckOutput, "warn: %s\n", warning)
+		}
+		if failed {
+			fmt.Fprintf(&individualCheckOutput, "%s check failed\n", name)
+		} else {
+			fmt.Fprintf(&individualCheckOutput, "%s check passed\n", name)
+		}
+		return ctx.Status(statusCode).SendString(individualCheckOutput.String())
+	}
+}
+
+// handleCheckHealth returns a handler that runs only the given check.
+func handleCheckHealth(options HandlerOptions, check HealthzChecker) fiber.Handler {
 	return func(ctx *fiber.Ctx) error {
-		// var individualCheckOutput bytes.Buffer
-		for _, check := range checks {
-			if err := check.Check(ctx.Request()); err != nil {
-				return ctx.Status(fasthttp.StatusNotFound).JSON(GetHealthzResponse(check.Name(), 1))
+		checkCtx, cancel := options.context()
+		defer cancel()
+		if err := options.runConcurrently(checkCtx, ctx.Request(), check)[0]; err != nil {
+			return ctx.Status(fasthttp.StatusNotFound).JSON(&ComponentResponse{
+				Status:  checkStatus(err),
+				Details: map[string]interface{}{"error": err.Error()},
+			})
+		}
+		return ctx.Status(fasthttp.StatusOK).JSON(&ComponentResponse{Status: StatusUp})
+	}
+}
+
+// runChecks runs every check which is not excluded and returns the result of
+// each one in the order they were registered. Exclusions that don't match any
+// check are reported back as warnings.
+func runChecks(req *fasthttp.Request, options HandlerOptions, excluded map[string]struct{}, checks ...HealthzChecker) ([]CheckResult, []string) {
+	results := make([]CheckResult, len(checks))
+	var toRun []HealthzChecker
+	var toRunIndex []int
+	for i, check := range checks {
+		results[i].Name = check.Name()
+		if _, ok := excluded[check.Name()]; ok {
+			delete(excluded, check.Name())
+			results[i].Status = CheckStatusExcluded
+			continue
+		}
+		toRun = append(toRun, check)
+		toRunIndex = append(toRunIndex, i)
+	}
+
+	ctx, cancel := options.context()
+	defer cancel()
+	for i, err := range options.runConcurrently(ctx, req, toRun...) {
+		result := &results[toRunIndex[i]]
+		if err != nil {
+			result.Status = CheckStatusFailed
+			result.Reason = err.Error()
+			continue
+		}
+		result.Status = CheckStatusOK
+	}
+
+	var warnings []string
+	if len(excluded) > 0 {
+		names := make([]string, 0, len(excluded))
+		for name := range excluded {
+			names = append(names, fmt.Sprintf("%q", name))
+		}
+		sort.Strings(names)
+		warnings = append(warnings, fmt.Sprintf("some health checks cannot be excluded: no matches for %s", strings.Join(names, " ")))
+	}
+	return results, warnings
+}
+
+// getExcludedChecks extracts the health check names to be excluded from the query param.
+func getExcludedChecks(ctx *fiber.Ctx) map[string]struct{} {
+	excluded := make(map[string]struct{})
+	for _, value := range ctx.Context().QueryArgs().PeekMulti("exclude") {
+		for _, name := range strings.Split(string(value), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				excluded[name] = struct{}{}
 			}
 		}
-		return ctx.Status(fasthttp.StatusOK).JSON(GetHealthzResponse(name, 0))
 	}
+	return excluded
+}
+
+const (
+	CheckStatusOK       = "ok"
+	CheckStatusFailed   = "failed"
+	CheckStatusExcluded = "excluded"
+)
+
+// CheckResult is the outcome of a single health check.
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// VerboseHealthzResponse is the json form of the ?verbose output.
+type VerboseHealthzResponse struct {
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Checks   []CheckResult `json:"checks"`
+	Warnings []string      `json:"warnings,omitempty"`
 }
 
 func GetHealthzResponse(name string, code int) *HealthzResponse {
@@ -98,7 +291,7 @@ func GetHealthzResponse(name string, code int) *HealthzResponse {
 	case "readiness":
 		return NewHealthzResponse((&ReadinessComponent{}).SetStatus(code))
 	}
-	return nil
+	return NewHealthzResponse(NewStateComponent(name).SetStatus(code))
 }
 
 type HealthzResponse struct {
@@ -156,6 +349,39 @@ func (r *ReadinessComponent) GetStatus() string {
 	return r.ReadinessState.Status
 }
 
+// ComponentResponse is the status of a single check along with optional details.
+type ComponentResponse struct {
+	Status  string                 `json:"status"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+var _ Components = StateComponent{}
+
+// StateComponent is the Components of any group other than liveness and readiness.
+type StateComponent map[string]*Status
+
+func NewStateComponent(name string) StateComponent {
+	return StateComponent{name + "state": &Status{}}
+}
+
+func (s StateComponent) SetStatus(code int) Components {
+	for _, state := range s {
+		if code == 0 {
+			state.Status = StatusUp
+		} else {
+			state.Status = StatusDown
+		}
+	}
+	return s
+}
+
+func (s StateComponent) GetStatus() string {
+	for _, state := range s {
+		return state.Status
+	}
+	return StatusUnknown
+}
+
 type Status struct {
 	Status string `json:"status"`
 }
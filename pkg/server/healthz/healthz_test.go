@@ -0,0 +1,193 @@
+package healthz
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+type fakeCheck struct {
+	name string
+	err  error
+}
+
+func (c fakeCheck) Name() string {
+	return c.name
+}
+
+func (c fakeCheck) Check(req *fasthttp.Request) error {
+	return c.err
+}
+
+// get sends a GET request for path to app and returns the status code and body.
+func get(t *testing.T, app *fiber.App, path string) (int, string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, path, nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestRootHealthVerbose(t *testing.T) {
+	tests := []struct {
+		name     string
+		checks   []HealthzChecker
+		query    string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "all pass",
+			checks:   []HealthzChecker{fakeCheck{name: "a"}, fakeCheck{name: "b"}},
+			query:    "?verbose",
+			wantCode: fiber.StatusOK,
+			wantBody: "[+]a ok\n[+]b ok\nreadiness check passed\n",
+		},
+		{
+			name:     "every check runs",
+			checks:   []HealthzChecker{fakeCheck{name: "a", err: errors.New("boom")}, fakeCheck{name: "b"}, fakeCheck{name: "c", err: errors.New("bang")}},
+			query:    "?verbose",
+			wantCode: fiber.StatusNotFound,
+			wantBody: "[-]a failed: boom\n[+]b ok\n[-]c failed: bang\nreadiness check failed\n",
+		},
+		{
+			name:     "exclude",
+			checks:   []HealthzChecker{fakeCheck{name: "a", err: errors.New("boom")}, fakeCheck{name: "b"}},
+			query:    "?verbose&exclude=a",
+			wantCode: fiber.StatusOK,
+			wantBody: "[+]a excluded: ok\n[+]b ok\nreadiness check passed\n",
+		},
+		{
+			name:     "exclude several",
+			checks:   []HealthzChecker{fakeCheck{name: "a", err: errors.New("boom")}, fakeCheck{name: "b", err: errors.New("bang")}, fakeCheck{name: "c"}},
+			query:    "?verbose&exclude=a&exclude=b,c",
+			wantCode: fiber.StatusOK,
+			wantBody: "[+]a excluded: ok\n[+]b excluded: ok\n[+]c excluded: ok\nreadiness check passed\n",
+		},
+		{
+			name:     "exclude unknown",
+			checks:   []HealthzChecker{fakeCheck{name: "a"}},
+			query:    "?verbose&exclude=missing",
+			wantCode: fiber.StatusOK,
+			wantBody: "[+]a ok\nwarn: some health checks cannot be excluded: no matches for \"missing\"\nreadiness check passed\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			InstallReadyzHandler(app, tt.checks...)
+
+			code, body := get(t, app, "/readiness"+tt.query)
+			if code != tt.wantCode {
+				t.Errorf("status code = %d, want %d", code, tt.wantCode)
+			}
+			if body != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRootHealthVerboseJSON(t *testing.T) {
+	app := fiber.New()
+	InstallLivezHandler(app, fakeCheck{name: "a", err: errors.New("boom")}, fakeCheck{name: "b"}, fakeCheck{name: "c"})
+
+	code, body := get(t, app, "/liveness?verbose&format=json&exclude=c&exclude=missing")
+	if code != fiber.StatusNotFound {
+		t.Errorf("status code = %d, want %d", code, fiber.StatusNotFound)
+	}
+	var got VerboseHealthzResponse
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("invalid body %q: %v", body, err)
+	}
+	want := VerboseHealthzResponse{
+		Name:   "liveness",
+		Status: "failed",
+		Checks: []CheckResult{
+			{Name: "a", Status: CheckStatusFailed, Reason: "boom"},
+			{Name: "b", Status: CheckStatusOK},
+			{Name: "c", Status: CheckStatusExcluded},
+		},
+		Warnings: []string{`some health checks cannot be excluded: no matches for "missing"`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("response = %+v, want %+v", got, want)
+	}
+}
+
+func TestRootHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		install    func(mux mux, checks ...HealthzChecker)
+		checks     []HealthzChecker
+		wantCode   int
+		wantStatus string
+	}{
+		{
+			name:       "liveness up",
+			path:       "/liveness",
+			install:    InstallLivezHandler,
+			checks:     []HealthzChecker{fakeCheck{name: "a"}},
+			wantCode:   fiber.StatusOK,
+			wantStatus: StatusUp,
+		},
+		{
+			name:       "liveness down",
+			path:       "/liveness",
+			install:    InstallLivezHandler,
+			checks:     []HealthzChecker{fakeCheck{name: "a", err: errors.New("boom")}},
+			wantCode:   fiber.StatusNotFound,
+			wantStatus: StatusDown,
+		},
+		{
+			name:       "readiness out of service",
+			path:       "/readiness",
+			install:    InstallReadyzHandler,
+			checks:     []HealthzChecker{fakeCheck{name: "a"}, fakeCheck{name: "b", err: errors.New("boom")}},
+			wantCode:   fiber.StatusNotFound,
+			wantStatus: StatusOutOfService,
+		},
+		{
+			name:       "excluded failure",
+			path:       "/readiness?exclude=b",
+			install:    InstallReadyzHandler,
+			checks:     []HealthzChecker{fakeCheck{name: "a"}, fakeCheck{name: "b", err: errors.New("boom")}},
+			wantCode:   fiber.StatusOK,
+			wantStatus: StatusUp,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			tt.install(app, tt.checks...)
+
+			code, body := get(t, app, tt.path)
+			if code != tt.wantCode {
+				t.Errorf("status code = %d, want %d", code, tt.wantCode)
+			}
+			var got struct {
+				Status string `json:"status"`
+			}
+			if err := json.Unmarshal([]byte(body), &got); err != nil {
+				t.Fatalf("invalid body %q: %v", body, err)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
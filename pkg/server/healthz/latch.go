@@ -0,0 +1,52 @@
+package healthz
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+)
+
+// NewLatchedChecker returns a checker which runs check until it succeeds once.
+// From then on it is healthy without running check anymore. This is what
+// startup checks need, they must not turn red again once the server started.
+func NewLatchedChecker(check HealthzChecker) HealthzContextChecker {
+	return &latchedChecker{check: check}
+}
+
+type latchedChecker struct {
+	check   HealthzChecker
+	latched atomic.Bool
+}
+
+func (c *latchedChecker) Name() string {
+	return c.check.Name()
+}
+
+func (c *latchedChecker) Check(req *fasthttp.Request) error {
+	return c.CheckContext(context.Background(), req)
+}
+
+func (c *latchedChecker) CheckContext(ctx context.Context, req *fasthttp.Request) error {
+	if c.latched.Load() {
+		return nil
+	}
+	var err error
+	if cc, ok := c.check.(HealthzContextChecker); ok {
+		err = cc.CheckContext(ctx, req)
+	} else {
+		err = c.check.Check(req)
+	}
+	if err != nil {
+		return err
+	}
+	c.latched.Store(true)
+	return nil
+}
+
+func (c *latchedChecker) Details() map[string]interface{} {
+	if provider, ok := c.check.(HealthzDetailsProvider); ok {
+		return provider.Details()
+	}
+	return nil
+}
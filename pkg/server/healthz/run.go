@@ -0,0 +1,95 @@
+package healthz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// HealthzContextChecker is a HealthzChecker which is able to cancel its work
+// once ctx is done, e.g. because the check timed out.
+type HealthzContextChecker interface {
+	HealthzChecker
+	CheckContext(ctx context.Context, req *fasthttp.Request) error
+}
+
+// HandlerOptions configures how the handlers of this package run their checks.
+// Checks of a request always run concurrently.
+type HandlerOptions struct {
+	// CheckTimeout bounds the duration of every single check. Zero means no timeout.
+	CheckTimeout time.Duration
+	// Timeout bounds the duration of all checks of a request. Zero means no timeout.
+	Timeout time.Duration
+	// FirstTimeHealthy, if set, is called exactly once when all checks of a
+	// path succeed for the first time.
+	FirstTimeHealthy func()
+}
+
+// context returns the context bounding all checks of a request.
+func (o HandlerOptions) context() (context.Context, context.CancelFunc) {
+	if o.Timeout > 0 {
+		return context.WithTimeout(context.Background(), o.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// runCheck runs check in its own goroutine and waits for it until it returns or
+// until either ctx or the per check timeout is done. req must not be shared
+// with the request as the check may outlive it.
+func (o HandlerOptions) runCheck(ctx context.Context, req *fasthttp.Request, check HealthzChecker) error {
+	checkCtx, cancel := ctx, context.CancelFunc(func() {})
+	if o.CheckTimeout > 0 {
+		checkCtx, cancel = context.WithTimeout(ctx, o.CheckTimeout)
+	}
+	defer cancel()
+
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		if c, ok := check.(HealthzContextChecker); ok {
+			errCh <- c.CheckContext(checkCtx, req)
+			return
+		}
+		errCh <- check.Check(req)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-checkCtx.Done():
+		if !errors.Is(checkCtx.Err(), context.DeadlineExceeded) {
+			return checkCtx.Err()
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("timed out after %v", o.Timeout)
+		}
+		return fmt.Errorf("timed out after %v", o.CheckTimeout)
+	}
+}
+
+// runConcurrently runs all checks concurrently and returns their errors in
+// the order of checks. Every check gets its own copy of req.
+func (o HandlerOptions) runConcurrently(ctx context.Context, req *fasthttp.Request, checks ...HealthzChecker) []error {
+	errs := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		checkReq := &fasthttp.Request{}
+		req.CopyTo(checkReq)
+
+		wg.Add(1)
+		go func(i int, check HealthzChecker) {
+			defer wg.Done()
+			errs[i] = o.runCheck(ctx, checkReq, check)
+		}(i, check)
+	}
+	wg.Wait()
+	return errs
+}
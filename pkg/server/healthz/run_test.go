@@ -0,0 +1,154 @@
+package healthz
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+)
+
+// sleepCheck returns after delay or, if it honors its context, once ctx is done.
+type sleepCheck struct {
+	name  string
+	delay time.Duration
+	// cancelled, if set, receives the error of the context once it is done.
+	cancelled chan error
+}
+
+func (c sleepCheck) Name() string {
+	return c.name
+}
+
+func (c sleepCheck) Check(req *fasthttp.Request) error {
+	time.Sleep(c.delay)
+	return nil
+}
+
+type contextSleepCheck struct {
+	sleepCheck
+}
+
+func (c contextSleepCheck) CheckContext(ctx context.Context, req *fasthttp.Request) error {
+	select {
+	case <-time.After(c.delay):
+		return nil
+	case <-ctx.Done():
+		if c.cancelled != nil {
+			c.cancelled <- ctx.Err()
+		}
+		return ctx.Err()
+	}
+}
+
+type panicCheck struct{}
+
+func (panicCheck) Name() string {
+	return "panic"
+}
+
+func (panicCheck) Check(req *fasthttp.Request) error {
+	panic("oops")
+}
+
+func TestRunConcurrently(t *testing.T) {
+	tests := []struct {
+		name    string
+		options HandlerOptions
+		checks  []HealthzChecker
+		// wantErrs are substrings of the expected errors, empty for no error.
+		wantErrs []string
+		// maxDuration bounds how long all checks may take.
+		maxDuration time.Duration
+	}{
+		{
+			name:        "concurrent",
+			checks:      []HealthzChecker{sleepCheck{name: "a", delay: 100 * time.Millisecond}, sleepCheck{name: "b", delay: 100 * time.Millisecond}, sleepCheck{name: "c", delay: 100 * time.Millisecond}},
+			wantErrs:    []string{"", "", ""},
+			maxDuration: 250 * time.Millisecond,
+		},
+		{
+			name:        "errors in order",
+			checks:      []HealthzChecker{fakeCheck{name: "a", err: errors.New("a failed")}, fakeCheck{name: "b"}, fakeCheck{name: "c", err: errors.New("c failed")}},
+			wantErrs:    []string{"a failed", "", "c failed"},
+			maxDuration: time.Second,
+		},
+		{
+			name:        "per check timeout",
+			options:     HandlerOptions{CheckTimeout: 50 * time.Millisecond},
+			checks:      []HealthzChecker{sleepCheck{name: "slow", delay: time.Second}, sleepCheck{name: "fast"}},
+			wantErrs:    []string{"timed out after 50ms", ""},
+			maxDuration: 500 * time.Millisecond,
+		},
+		{
+			name:        "overall timeout",
+			options:     HandlerOptions{CheckTimeout: time.Second, Timeout: 50 * time.Millisecond},
+			checks:      []HealthzChecker{sleepCheck{name: "slow", delay: 2 * time.Second}, sleepCheck{name: "fast"}},
+			wantErrs:    []string{"timed out after 50ms", ""},
+			maxDuration: 500 * time.Millisecond,
+		},
+		{
+			name:        "panic",
+			checks:      []HealthzChecker{panicCheck{}},
+			wantErrs:    []string{"panic: oops"},
+			maxDuration: time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.options.context()
+			defer cancel()
+
+			start := time.Now()
+			errs := tt.options.runConcurrently(ctx, &fasthttp.Request{}, tt.checks...)
+			if elapsed := time.Since(start); elapsed > tt.maxDuration {
+				t.Errorf("checks took %v, want at most %v", elapsed, tt.maxDuration)
+			}
+			for i, err := range errs {
+				want := tt.wantErrs[i]
+				switch {
+				case len(want) == 0 && err != nil:
+					t.Errorf("check %s failed: %v", tt.checks[i].Name(), err)
+				case len(want) > 0 && (err == nil || !strings.Contains(err.Error(), want)):
+					t.Errorf("check %s error = %v, want %q", tt.checks[i].Name(), err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRunCheckCancelsContext(t *testing.T) {
+	cancelled := make(chan error, 1)
+	check := contextSleepCheck{sleepCheck{name: "slow", delay: time.Second, cancelled: cancelled}}
+	options := HandlerOptions{CheckTimeout: 50 * time.Millisecond}
+
+	if err := options.runCheck(context.Background(), &fasthttp.Request{}, check); err == nil {
+		t.Fatal("expected the check to time out")
+	}
+	select {
+	case err := <-cancelled:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("context error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Error("the context of the check was not cancelled")
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	app := fiber.New()
+	InstallReadyzHandlerWithOptions(app, HandlerOptions{CheckTimeout: 50 * time.Millisecond},
+		sleepCheck{name: "slow", delay: time.Second}, fakeCheck{name: "fast"})
+
+	code, body := get(t, app, "/readiness?verbose")
+	if code != fiber.StatusNotFound {
+		t.Errorf("status code = %d, want %d", code, fiber.StatusNotFound)
+	}
+	want := "[-]slow failed: timed out after 50ms\n[+]fast ok\nreadiness check failed\n"
+	if body != want {
+		t.Errorf("body = %q, want %q", body, want)
+	}
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+// PostStartHookFunc is a function that is called after the server has started.
+// It must properly handle cases like:
+//  1. asynchronous start in multiple API server processes
+//  2. conflicts between the different processes all trying to perform the same action
+//  3. partially complete work (API server crashes while running your hook)
+//  4. API server access **BEFORE** your hook has completed
+//
+// ctx is cancelled when the server stops accepting new requests.
+type PostStartHookFunc func(ctx context.Context) error
+
+// PreShutdownHookFunc is a function that can be added to the shutdown logic.
+type PreShutdownHookFunc func() error
+
+// postStartHookEntry is used to add a PostStartHookFunc to the server.
+type postStartHookEntry struct {
+	hook PostStartHookFunc
+	// done will be closed when the postHook is finished
+	done chan struct{}
+	// failure holds the error of the postHook once it failed
+	failure *postStartHookFailure
+}
+
+type postStartHookFailure struct {
+	lock sync.Mutex
+	err  error
+}
+
+func (f *postStartHookFailure) set(err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.err = err
+}
+
+func (f *postStartHookFailure) get() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.err
+}
+
+type preShutdownHookEntry struct {
+	hook PreShutdownHookFunc
+}
+
+// AddPostStartHook allows you to add a PostStartHook that will be called after the listener is bound.
+// Every hook gets a readiness check "poststarthook/<name>" which fails until the hook has finished.
+func (s *GenericAPIServer) AddPostStartHook(name string, hook PostStartHookFunc) error {
+	if len(name) == 0 {
+		return fmt.Errorf("missing name")
+	}
+	if hook == nil {
+		return fmt.Errorf("hook func may not be nil: %q", name)
+	}
+
+	s.postStartHookLock.Lock()
+	defer s.postStartHookLock.Unlock()
+
+	if s.postStartHooksCalled {
+		return fmt.Errorf("unable to add %q because PostStartHooks have already been called", name)
+	}
+	if _, exists := s.postStartHooks[name]; exists {
+		return fmt.Errorf("unable to add %q because it was already registered", name)
+	}
+
+	// done is closed when the poststarthook is finished. This is used by the readiness check to be able to indicate
+	// that the poststarthook is finished.
+	done := make(chan struct{})
+	failure := &postStartHookFailure{}
+	if err := s.AddReadyzChecks(postStartHookHealthz{name: "poststarthook/" + name, done: done, failure: failure}); err != nil {
+		return err
+	}
+	if s.postStartHooks == nil {
+		s.postStartHooks = map[string]postStartHookEntry{}
+	}
+	s.postStartHooks[name] = postStartHookEntry{hook: hook, done: done, failure: failure}
+
+	return nil
+}
+
+// AddPreShutdownHook allows you to add a PreShutdownHook that will be called
+// once shutdown is initiated. The server stops accepting new requests only
+// after all of them have returned.
+func (s *GenericAPIServer) AddPreShutdownHook(name string, hook PreShutdownHookFunc) error {
+	if len(name) == 0 {
+		return fmt.Errorf("missing name")
+	}
+	if hook == nil {
+		return fmt.Errorf("hook func may not be nil: %q", name)
+	}
+
+	s.preShutdownHookLock.Lock()
+	defer s.preShutdownHookLock.Unlock()
+
+	if s.preShutdownHooksCalled {
+		return fmt.Errorf("unable to add %q because PreShutdownHooks have already been called", name)
+	}
+	if _, exists := s.preShutdownHooks[name]; exists {
+		return fmt.Errorf("unable to add %q because it is already registered", name)
+	}
+
+	if s.preShutdownHooks == nil {
+		s.preShutdownHooks = map[string]preShutdownHookEntry{}
+	}
+	s.preShutdownHooks[name] = preShutdownHookEntry{hook: hook}
+
+	return nil
+}
+
+// RunPostStartHooks runs the PostStartHooks for the server. Every hook runs
+// in its own goroutine, PostStartHooksCompleted is signaled once all of them
+// have completed successfully. The error of a failed hook is reported by its
+// readiness check and by the startup check.
+func (s *GenericAPIServer) RunPostStartHooks(ctx context.Context) {
+	s.postStartHookLock.Lock()
+	defer s.postStartHookLock.Unlock()
+	s.postStartHooksCalled = true
+
+	var wg sync.WaitGroup
+	var failedLock sync.Mutex
+	var failed []string
+	for hookName, hookEntry := range s.postStartHooks {
+		wg.Add(1)
+		go func(hookName string, hookEntry postStartHookEntry) {
+			defer wg.Done()
+			if err := runPostStartHook(ctx, hookName, hookEntry); err != nil {
+				fmt.Printf("PostStartHook %q failed: %v\n", hookName, err)
+				hookEntry.failure.set(err)
+				failedLock.Lock()
+				defer failedLock.Unlock()
+				failed = append(failed, hookName)
+			}
+		}(hookName, hookEntry)
+	}
+
+	go func() {
+		wg.Wait()
+		if len(failed) > 0 {
+			return
+		}
+		s.lifecycleSignals.PostStartHooksCompleted.Signal()
+	}()
+}
+
+// postStartHooksFailure returns the errors of all failed PostStartHooks.
+func (s *GenericAPIServer) postStartHooksFailure() error {
+	s.postStartHookLock.Lock()
+	defer s.postStartHookLock.Unlock()
+
+	names := make([]string, 0, len(s.postStartHooks))
+	for name := range s.postStartHooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errorList []error
+	for _, name := range names {
+		if err := s.postStartHooks[name].failure.get(); err != nil {
+			errorList = append(errorList, fmt.Errorf("PostStartHook %q failed: %v", name, err))
+		}
+	}
+	return errors.Join(errorList...)
+}
+
+// RunPreShutdownHooks runs the PreShutdownHooks for the server
+func (s *GenericAPIServer) RunPreShutdownHooks() error {
+	var errorList []error
+
+	s.preShutdownHookLock.Lock()
+	defer s.preShutdownHookLock.Unlock()
+	s.preShutdownHooksCalled = true
+
+	for hookName, hookEntry := range s.preShutdownHooks {
+		if err := runPreShutdownHook(hookName, hookEntry); err != nil {
+			errorList = append(errorList, err)
+		}
+	}
+	return errors.Join(errorList...)
+}
+
+func runPostStartHook(ctx context.Context, name string, entry postStartHookEntry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if err = entry.hook(ctx); err != nil {
+		return err
+	}
+	close(entry.done)
+	return nil
+}
+
+func runPreShutdownHook(name string, entry preShutdownHookEntry) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("PreShutdownHook %q panicked: %v", name, r)
+		}
+	}()
+	if err = entry.hook(); err != nil {
+		return fmt.Errorf("PreShutdownHook %q failed: %v", name, err)
+	}
+	return nil
+}
+
+// postStartHookHealthz implements a healthz check for poststarthooks. It will return a "hookNotFinished"
+// error until the poststarthook is finished.
+type postStartHookHealthz struct {
+	name string
+
+	// done will be closed when the postStartHook is finished
+	done chan struct{}
+	// failure holds the error of the postStartHook once it failed
+	failure *postStartHookFailure
+}
+
+func (h postStartHookHealthz) Name() string {
+	return h.name
+}
+
+var errHookNotFinished = errors.New("not finished")
+
+func (h postStartHookHealthz) Check(req *fasthttp.Request) error {
+	select {
+	case <-h.done:
+		return nil
+	default:
+	}
+	if err := h.failure.get(); err != nil {
+		return err
+	}
+	return errHookNotFinished
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddPostStartHook(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+
+	tests := []struct {
+		name     string
+		hookName string
+		hook     PostStartHookFunc
+		// called runs the hooks before hookName is added.
+		called  bool
+		wantErr string
+	}{
+		{name: "valid", hookName: "new", hook: noop},
+		{name: "missing name", hookName: "", hook: noop, wantErr: "missing name"},
+		{name: "nil hook", hookName: "new", hook: nil, wantErr: "hook func may not be nil"},
+		{name: "duplicate name", hookName: "existing", hook: noop, wantErr: "already registered"},
+		{name: "already called", hookName: "new", hook: noop, called: true, wantErr: "have already been called"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			if err := s.AddPostStartHook("existing", noop); err != nil {
+				t.Fatal(err)
+			}
+			if tt.called {
+				s.RunPostStartHooks(context.Background())
+			}
+
+			err := s.AddPostStartHook(tt.hookName, tt.hook)
+			switch {
+			case len(tt.wantErr) == 0 && err != nil:
+				t.Errorf("AddPostStartHook() error = %v", err)
+			case len(tt.wantErr) > 0 && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("AddPostStartHook() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// waitFor polls condition until it is true or fails the test after a second.
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunPostStartHooks(t *testing.T) {
+	blockCh := make(chan struct{})
+	defer close(blockCh)
+
+	tests := []struct {
+		name  string
+		hooks map[string]PostStartHookFunc
+		// wantReadiness and wantStartup are lines of the verbose probes once the hooks ran.
+		wantReadiness []string
+		wantStartup   string
+		wantCompleted bool
+	}{
+		{
+			name: "success",
+			hooks: map[string]PostStartHookFunc{
+				"a": func(ctx context.Context) error { return nil },
+				"b": func(ctx context.Context) error { return nil },
+			},
+			wantReadiness: []string{"[+]poststarthook/a ok", "[+]poststarthook/b ok"},
+			wantStartup:   "[+]poststarthooks ok",
+			wantCompleted: true,
+		},
+		{
+			name: "failure",
+			hooks: map[string]PostStartHookFunc{
+				"ok":   func(ctx context.Context) error { return nil },
+				"fail": func(ctx context.Context) error { return errors.New("boom") },
+			},
+			wantReadiness: []string{"[+]poststarthook/ok ok", "[-]poststarthook/fail failed: boom"},
+			wantStartup:   `[-]poststarthooks failed: PostStartHook "fail" failed: boom`,
+		},
+		{
+			name: "panic",
+			hooks: map[string]PostStartHookFunc{
+				"panic": func(ctx context.Context) error { panic("oops") },
+			},
+			wantReadiness: []string{"[-]poststarthook/panic failed: panic: oops"},
+			wantStartup:   `[-]poststarthooks failed: PostStartHook "panic" failed: panic: oops`,
+		},
+		{
+			name: "not finished",
+			hooks: map[string]PostStartHookFunc{
+				"ok": func(ctx context.Context) error { return nil },
+				"blocking": func(ctx context.Context) error {
+					<-blockCh
+					return nil
+				},
+			},
+			wantReadiness: []string{"[+]poststarthook/ok ok", "[-]poststarthook/blocking failed: not finished"},
+			wantStartup:   "[-]poststarthooks failed: not all post-start hooks have completed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			for name, hook := range tt.hooks {
+				if err := s.AddPostStartHook(name, hook); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.PrepareRun()
+			s.RunPostStartHooks(context.Background())
+
+			contains := func(path string, lines ...string) func() bool {
+				return func() bool {
+					_, body := get(t, s, path)
+					for _, line := range lines {
+						if !strings.Contains(body, line+"\n") {
+							return false
+						}
+					}
+					return true
+				}
+			}
+			waitFor(t, contains("/actuator/health/readiness?verbose", tt.wantReadiness...))
+			waitFor(t, contains("/actuator/health/startup?verbose", tt.wantStartup))
+
+			select {
+			case <-s.lifecycleSignals.PostStartHooksCompleted.Signaled():
+				if !tt.wantCompleted {
+					t.Error("PostStartHooksCompleted was signaled")
+				}
+			default:
+				if tt.wantCompleted {
+					t.Error("PostStartHooksCompleted was not signaled")
+				}
+			}
+		})
+	}
+}
+
+func TestPreShutdownHooks(t *testing.T) {
+	s := newTestServer(t, nil)
+	ran := false
+	hooks := map[string]PreShutdownHookFunc{
+		"ok": func() error {
+			ran = true
+			return nil
+		},
+		"fail":  func() error { return errors.New("boom") },
+		"panic": func() error { panic("oops") },
+	}
+	for name, hook := range hooks {
+		if err := s.AddPreShutdownHook(name, hook); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddPreShutdownHook("ok", hooks["ok"]); err == nil {
+		t.Error("expected a duplicate name to be rejected")
+	}
+
+	err := s.RunPreShutdownHooks()
+	if !ran {
+		t.Error("the successful hook did not run")
+	}
+	for _, want := range []string{`PreShutdownHook "fail" failed: boom`, `PreShutdownHook "panic" panicked: oops`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("RunPreShutdownHooks() error = %v, want %q", err, want)
+		}
+	}
+	if err := s.AddPreShutdownHook("late", hooks["ok"]); err == nil {
+		t.Error("expected a hook added after the hooks ran to be rejected")
+	}
+}
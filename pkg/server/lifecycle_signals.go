@@ -1,13 +1,12 @@
 package server
 
-import "sync"
-
-type lifecycleSignal interface {
-	// Signal signals the event, indicating that the event has occurred.
-	// Signal is idempotent, once signaled the event stays signaled and
-	// it immediately unblocks any goroutine waiting for this event.
-	Signal()
+import (
+	"fmt"
+	"sync"
+)
 
+// LifecycleSignal is the read-only view of a lifecycle event of the apiserver.
+type LifecycleSignal interface {
 	// Singaled returns a channel that is closed when the underling event
 	// has been signaled. Successive calls to Signaled return the same value.
 	Signaled() <-chan struct{}
@@ -16,6 +15,15 @@ type lifecycleSignal interface {
 	Name() string
 }
 
+type lifecycleSignal interface {
+	LifecycleSignal
+
+	// Signal signals the event, indicating that the event has occurred.
+	// Signal is idempotent, once signaled the event stays signaled and
+	// it immediately unblocks any goroutine waiting for this event.
+	Signal()
+}
+
 // lifecycleSignals provides an abstraction of the events that
 // transpire during the lifecycle of the apiserver. This abstraction makes it esay
 // for use to write unit tests that can verify expected gracefull termination bahavior.
@@ -46,6 +54,17 @@ type lifecycleSignals struct {
 	// HTTPServerStoppedListening event is signaled when the the
 	// HTTP server has stopped listening to the underlying socket.
 	HTTPServerStoppedListening lifecycleSignal
+
+	// PostStartHooksCompleted event is signaled when all post-start
+	// hooks have completed successfully after the listener was bound.
+	PostStartHooksCompleted lifecycleSignal
+
+	// HasBeenReady is signaled when the readyz endpoint succeeds for the first time.
+	HasBeenReady lifecycleSignal
+
+	// InFlightRequestsDrained event is signaled when the existing requests
+	// in flight have completed after the server stopped accepting new ones.
+	InFlightRequestsDrained lifecycleSignal
 }
 
 // ShuttingDown returns the lifecycle signal that is signaled when
@@ -65,7 +84,97 @@ func newLifecycleSignals() lifecycleSignals {
 		PreShutdownHooksStopped:    newNamedChannelWrapper("PreShutdownHooksStopped"),
 		NotAcceptingNewRequest:     newNamedChannelWrapper("NotAcceptingNewRequest"),
 		HTTPServerStoppedListening: newNamedChannelWrapper("HTTPServerStoppedListening"),
+		PostStartHooksCompleted:    newNamedChannelWrapper("PostStartHooksCompleted"),
+		HasBeenReady:               newNamedChannelWrapper("HasBeenReady"),
+		InFlightRequestsDrained:    newNamedChannelWrapper("InFlightRequestsDrained"),
+	}
+}
+
+// LifecycleSignals is the read-only view of the events that transpire during the
+// lifecycle of the apiserver, in the order they are usually signaled. Handlers and
+// background workers can wait on them to wind down cooperatively.
+type LifecycleSignals struct {
+	// PostStartHooksCompleted is signaled when all post-start hooks have completed successfully.
+	PostStartHooksCompleted LifecycleSignal
+	// HasBeenReady is signaled when the readyz endpoint succeeds for the first time.
+	HasBeenReady LifecycleSignal
+	// ShutdownInitiated is signaled when the server shutdown has been initiated.
+	ShutdownInitiated LifecycleSignal
+	// AfterShutdownDelayDuration is signaled as soon as ShutdownDelayDuration has
+	// elapsed since ShutdownInitiated.
+	AfterShutdownDelayDuration LifecycleSignal
+	// PreShutdownHooksStopped is signaled when all pre-shutdown hooks have finished running.
+	PreShutdownHooksStopped LifecycleSignal
+	// NotAcceptingNewRequest is signaled when the server no longer accepts new requests.
+	NotAcceptingNewRequest LifecycleSignal
+	// HTTPServerStoppedListening is signaled when the HTTP server has stopped listening.
+	HTTPServerStoppedListening LifecycleSignal
+	// InFlightRequestsDrained is signaled when the requests in flight have completed.
+	InFlightRequestsDrained LifecycleSignal
+}
+
+// ShuttingDown returns a channel that is closed when the server is not
+// accepting any new requests.
+func (s LifecycleSignals) ShuttingDown() <-chan struct{} {
+	return s.NotAcceptingNewRequest.Signaled()
+}
+
+// All returns every signal.
+func (s LifecycleSignals) All() []LifecycleSignal {
+	return []LifecycleSignal{
+		s.PostStartHooksCompleted,
+		s.HasBeenReady,
+		s.ShutdownInitiated,
+		s.AfterShutdownDelayDuration,
+		s.PreShutdownHooksStopped,
+		s.NotAcceptingNewRequest,
+		s.HTTPServerStoppedListening,
+		s.InFlightRequestsDrained,
+	}
+}
+
+// Get returns the signal with the given name.
+func (s LifecycleSignals) Get(name string) (LifecycleSignal, bool) {
+	for _, signal := range s.All() {
+		if signal.Name() == name {
+			return signal, true
+		}
+	}
+	return nil, false
+}
+
+// readOnly returns the read-only view of s.
+func (s lifecycleSignals) readOnly() LifecycleSignals {
+	return LifecycleSignals{
+		PostStartHooksCompleted:    s.PostStartHooksCompleted,
+		HasBeenReady:               s.HasBeenReady,
+		ShutdownInitiated:          s.ShutdownInitiated,
+		AfterShutdownDelayDuration: s.AfterShutdownDelayDuration,
+		PreShutdownHooksStopped:    s.PreShutdownHooksStopped,
+		NotAcceptingNewRequest:     s.NotAcceptingNewRequest,
+		HTTPServerStoppedListening: s.HTTPServerStoppedListening,
+		InFlightRequestsDrained:    s.InFlightRequestsDrained,
+	}
+}
+
+// LifecycleSignals returns the events that transpire during the lifecycle of
+// the server. The signals can only be waited on, they are signaled by the server.
+func (s *GenericAPIServer) LifecycleSignals() LifecycleSignals {
+	return s.lifecycleSignals.readOnly()
+}
+
+// OnLifecycleSignal calls callback in its own goroutine once the signal with
+// the given name has been signaled. It returns an error if there is no such signal.
+func (s *GenericAPIServer) OnLifecycleSignal(name string, callback func()) error {
+	signal, ok := s.LifecycleSignals().Get(name)
+	if !ok {
+		return fmt.Errorf("unknown lifecycle signal %q", name)
 	}
+	go func() {
+		<-signal.Signaled()
+		callback()
+	}()
+	return nil
 }
 
 func newNamedChannelWrapper(name string) lifecycleSignal {
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"net"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// NamedListener is a listener the server is served on in addition to ServingInfo.Listener.
+type NamedListener struct {
+	// Name identifies the listener in log messages, e.g. "admin".
+	Name string
+
+	Listener net.Listener
+
+	// Routes restricts the routes served on Listener to these path prefixes, e.g. "/actuator/health".
+	// All routes are served if empty.
+	Routes []string
+}
+
+// routesListener marks the connections it accepts with the routes they may request.
+type routesListener struct {
+	net.Listener
+	routes []string
+}
+
+func (ln routesListener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &routesConn{Conn: c, routes: ln.routes}, nil
+}
+
+type routesConn struct {
+	net.Conn
+	routes []string
+}
+
+// NetConn returns the underlying connection.
+func (c *routesConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// withListenerRoutes responds with 404 to requests for routes which are not served
+// on the listener the request was received on.
+func withListenerRoutes(handler fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if routes, ok := connRoutes(ctx.Conn()); ok && !matchesRoutes(string(ctx.Path()), routes) {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+			return
+		}
+		handler(ctx)
+	}
+}
+
+// connRoutes returns the routes of the routesConn wrapped by c, e.g. by a tls.Conn.
+func connRoutes(c net.Conn) ([]string, bool) {
+	for c != nil {
+		if rc, ok := c.(*routesConn); ok {
+			return rc.routes, true
+		}
+		wrapper, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil, false
+		}
+		c = wrapper.NetConn()
+	}
+	return nil, false
+}
+
+func matchesRoutes(path string, routes []string) bool {
+	for _, route := range routes {
+		route = strings.TrimSuffix(route, "/")
+		if path == route || strings.HasPrefix(path, route+"/") || len(route) == 0 {
+			return true
+		}
+	}
+	return false
+}
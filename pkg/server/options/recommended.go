@@ -33,6 +33,7 @@ func (o *RecommendedOptions) ApplyTo(config *server.RecommendedConfig) error {
 func (o *RecommendedOptions) Validate() []error {
 	errors := []error{}
 	errors = append(errors, o.CoreAPI.Validate()...)
+	errors = append(errors, o.Serving.Validate()...)
 
 	return errors
 }
@@ -2,11 +2,22 @@ package options
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
+	"time"
 
 	"github.com/ForbiddenR/apiserver/pkg/server"
+	"github.com/ForbiddenR/apiserver/pkg/server/dynamiccertificates"
+	"github.com/ForbiddenR/apiserver/pkg/util/activation"
+	certutil "github.com/ForbiddenR/apiserver/pkg/util/cert"
+	"github.com/ForbiddenR/apiserver/pkg/util/connlimit"
+	"github.com/ForbiddenR/apiserver/pkg/util/proxyproto"
 )
 
 type ServingOptions struct {
@@ -14,8 +25,15 @@ type ServingOptions struct {
 	// BindPort is ignored when Listener is set, will serve https even with 0.
 	BindPort int
 	// BindNetwork is the type of network to bind to - defaults to "tcp". accepts "tcp",
-	// "tcp4", and "tcp6"
+	// "tcp4", "tcp6" and "unix". For "unix", SocketPath is bound instead of BindAddress/BindPort.
 	BindNetwork string
+	// SocketPath is the path of the unix domain socket to serve on if BindNetwork is "unix".
+	// A stale socket left behind by a previous process is removed on startup, the socket is
+	// removed again once the server stops listening.
+	SocketPath string
+	// SocketMode is the file permission mode of the socket at SocketPath, e.g. 0660.
+	// If zero, the mode is determined by the umask of the process.
+	SocketMode os.FileMode
 	// Required set to true mean that BindPort cannot be zero.
 	Required bool
 	// ExternalAddress is the addrss advertised. even if BindAddress is a loopback. By default this
@@ -25,12 +43,121 @@ type ServingOptions struct {
 	// either Listener or BindAddress/Bindport/BindNetwork is,
 	// if Listener is set, use it and omit BindAddress/BindPort/BindNetwork.
 	Listener net.Listener
+	// SocketActivationName is the name (FileDescriptorName= of the systemd socket unit) of the
+	// socket passed via LISTEN_FDS to use as the listener. If empty, the passed socket is used
+	// if there is exactly one and it has no name, i.e. LISTEN_FDNAMES isn't set. A listener is
+	// only created if no matching socket was passed.
+	SocketActivationName string
+	// Routes restricts the routes served on the listener to these path prefixes, e.g. "/api".
+	// All routes are served if empty.
+	Routes []string
+	// AdditionalListeners are served alongside the listener above, with the same certificates.
+	// They are ignored if the listener above is turned off.
+	AdditionalListeners []NamedListenerOptions
+
+	// ReusePort sets SO_REUSEPORT on the tcp listeners so that several processes can serve the same port.
+	// ReusePort, Backlog, TCPFastOpenQueueLength and TCPUserTimeout only apply to listeners created
+	// from BindAddress/BindPort and are only supported on Linux.
+	ReusePort bool
+	// Backlog is the maximum length of the queue of pending connections. Zero uses the system default.
+	Backlog int
+	// TCPFastOpenQueueLength enables TCP_FASTOPEN with the given maximum length of the queue
+	// of pending fast open requests. Zero disables it.
+	TCPFastOpenQueueLength int
+	// TCPUserTimeout sets TCP_USER_TIMEOUT, the maximum time transmitted data may remain
+	// unacknowledged before the connection is closed. Zero uses the system default.
+	TCPUserTimeout time.Duration
+	// KeepAlivePeriod is the TCP keep-alive period of the accepted connections.
+	// Zero means 3 minutes, negative disables keep-alives.
+	KeepAlivePeriod time.Duration
+	// DisableTCPNoDelay enables Nagle's algorithm on the accepted connections, i.e. doesn't set TCP_NODELAY.
+	DisableTCPNoDelay bool
+
+	// ProxyProtocol reads the PROXY protocol v1 or v2 header a load balancer in front of the server
+	// sends on the connections of the listener above and of AdditionalListeners, so that requests
+	// see the address of the client.
+	// "optional" serves connections without the header with their own address, "strict" closes them.
+	// Empty disables the PROXY protocol.
+	ProxyProtocol string
+	// ProxyProtocolTrustedCIDRs are the addresses of the load balancers, e.g. "10.0.0.0/8". The header
+	// is only read from connections of these addresses. It is required by ProxyProtocol.
+	ProxyProtocolTrustedCIDRs []string
+
+	// MaxConnections is the maximum number of concurrently open connections of the listener above.
+	// MaxConnections, MaxConnectionsPerIP and MaxAcceptRate are disabled if zero. Connections
+	// exceeding them are closed right after they are accepted. They apply to each of
+	// AdditionalListeners as well, every listener with limits of its own.
+	MaxConnections int
+	// MaxConnectionsPerIP is the maximum number of concurrently open connections of a client IP.
+	MaxConnectionsPerIP int
+	// MaxAcceptRate is the maximum number of connections accepted per second on average.
+	MaxAcceptRate float64
+	// MaxAcceptBurst is the number of connections accepted at once beyond MaxAcceptRate.
+	MaxAcceptBurst int
+
+	// CertFile is a file containing a PEM-encoded certificate, and possibly the complete certificate chain.
+	// If CertFile and KeyFile are empty, plain http is served.
+	CertFile string
+	// KeyFile is a file containing a PEM-encoded private key for the certificate specified by CertFile.
+	KeyFile string
+	// CertDirectory is the directory where the self-signed certificates of
+	// MaybeDefaultWithSelfSignedCerts are cached. It is ignored if CertFile and KeyFile are set.
+	CertDirectory string
+	// PairName is the name used together with CertDirectory to make the cert and key file names,
+	// i.e. <CertDirectory>/<PairName>.crt and <CertDirectory>/<PairName>.key.
+	PairName string
+	// MinTLSVersion is the minimum TLS version supported, e.g. "VersionTLS12".
+	// Values are from tls package constants (https://golang.org/pkg/crypto/tls/#pkg-constants).
+	MinTLSVersion string
+	// CipherSuites is the list of allowed cipher suites for the server, e.g. "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256".
+	// If omitted, the default Go cipher suites will be used.
+	CipherSuites []string
+	// NextProtos is the list of application protocols advertised via ALPN, e.g. "http/1.1".
+	NextProtos []string
+
+	// SNICertKeys are named certificates selected by the server name of the TLS handshake.
+	// CertFile and KeyFile are served if none of them matches.
+	SNICertKeys []NamedCertKey
+
+	// ClientCAFile is a file containing the PEM-encoded bundle of the CAs which sign the client certificates
+	// to recognize. If set, the common name of a verified client certificate is used as the user of the request.
+	ClientCAFile string
+	// ClientCertRequired rejects clients which don't present a certificate signed by one of the CAs of ClientCAFile.
+	ClientCertRequired bool
+}
+
+// NamedCertKey is a certificate served for a set of TLS server names.
+type NamedCertKey struct {
+	// Names are the server names, possibly with a "*." wildcard prefix, the certificate is served for.
+	// If empty, the names are derived from the DNS SANs of the certificate, or its common name.
+	Names []string
+	// CertFile is a file containing a PEM-encoded certificate, and possibly the complete certificate chain.
+	CertFile string
+	// KeyFile is a file containing a PEM-encoded private key for the certificate specified by CertFile.
+	KeyFile string
+}
+
+// NamedListenerOptions is an additional listener, e.g. an admin port bound to localhost.
+type NamedListenerOptions struct {
+	// Name identifies the listener, e.g. "admin".
+	Name string
+	// BindAddress and BindPort are the tcp address to listen on.
+	BindAddress net.IP
+	BindPort    int
+	// Listener is used instead of BindAddress/BindPort if set. If not, the socket passed via
+	// LISTEN_FDS which is named Name is used if there is one.
+	Listener net.Listener
+	// Routes restricts the routes served on the listener to these path prefixes, e.g. "/actuator/health".
+	// All routes are served if empty.
+	Routes []string
 }
 
 func NewServingOptions() *ServingOptions {
 	return &ServingOptions{
-		BindAddress: net.IPv4(0, 0, 0, 0),
-		BindPort:    8080,
+		BindAddress:   net.IPv4(0, 0, 0, 0),
+		BindPort:      8080,
+		CertDirectory: "apiserver.local.config/certificates",
+		PairName:      "apiserver",
 	}
 }
 
@@ -38,35 +165,272 @@ func (s *ServingOptions) ApplyTo(config **server.ServingInfo) error {
 	if s == nil {
 		return nil
 	}
-	if s.BindPort <= 0 && s.Listener == nil {
+	if s.Listener == nil {
+		var err error
+		s.Listener, err = activation.TakeListener(s.SocketActivationName)
+		if err != nil {
+			return fmt.Errorf("failed to use socket activation listener: %v", err)
+		}
+	}
+
+	if s.BindPort <= 0 && s.Listener == nil && !s.isUnix() {
 		return nil
 	}
 
-	if s.Listener == nil {
+	if s.Listener == nil && s.isUnix() {
+		var err error
+		s.Listener, err = CreateUnixListener(s.SocketPath, s.SocketMode)
+		if err != nil {
+			return fmt.Errorf("failed to create listener: %v", err)
+		}
+	} else if s.Listener == nil {
 		var err error
 		addr := net.JoinHostPort(s.BindAddress.String(), strconv.Itoa(s.BindPort))
 
-		c := net.ListenConfig{}
+		c := net.ListenConfig{Control: s.control}
 
 		s.Listener, s.BindPort, err = CreateListener(s.BindNetwork, addr, c)
 		if err != nil {
 			return fmt.Errorf("failed to create listener: %v", err)
 		}
+		if err := setBacklog(s.Listener, s.Backlog); err != nil {
+			return err
+		}
 	} else {
-		if _, ok := s.Listener.Addr().(*net.TCPAddr); !ok {
+		switch addr := s.Listener.Addr().(type) {
+		case *net.TCPAddr:
+			s.BindPort = addr.Port
+			s.BindAddress = addr.IP
+		case *net.UnixAddr:
+			s.BindNetwork = "unix"
+			s.SocketPath = addr.Name
+		default:
 			return fmt.Errorf("failed to parse ip and port from listener")
 		}
-		s.BindPort = s.Listener.Addr().(*net.TCPAddr).Port
-		s.BindAddress = s.Listener.Addr().(*net.TCPAddr).IP
 	}
 
-	*config = &server.ServingInfo{
-		Listener: s.Listener,
+	c := &server.ServingInfo{
+		Listener:     s.Listener,
+		ListenerName: s.SocketActivationName,
+		Routes:       s.Routes,
+		NextProtos:   s.NextProtos,
+
+		KeepAlivePeriod:   s.KeepAlivePeriod,
+		DisableTCPNoDelay: s.DisableTCPNoDelay,
+	}
+	*config = c
+
+	if s.MaxConnections > 0 || s.MaxConnectionsPerIP > 0 || s.MaxAcceptRate > 0 {
+		c.ConnectionLimits = &connlimit.Options{
+			MaxConns:      s.MaxConnections,
+			MaxConnsPerIP: s.MaxConnectionsPerIP,
+			AcceptRate:    s.MaxAcceptRate,
+			AcceptBurst:   s.MaxAcceptBurst,
+		}
+	}
+
+	if len(s.ProxyProtocol) > 0 {
+		mode, err := proxyproto.ParseMode(s.ProxyProtocol)
+		if err != nil {
+			return err
+		}
+		trustedCIDRs, err := proxyproto.ParseCIDRs(s.ProxyProtocolTrustedCIDRs)
+		if err != nil {
+			return fmt.Errorf("invalid ProxyProtocolTrustedCIDRs: %v", err)
+		}
+		c.ProxyProtocol = &proxyproto.Options{Mode: mode, TrustedCIDRs: trustedCIDRs}
+	}
+
+	for i := range s.AdditionalListeners {
+		l := &s.AdditionalListeners[i]
+		if l.Listener == nil && len(l.Name) > 0 {
+			var err error
+			l.Listener, err = activation.TakeListener(l.Name)
+			if err != nil {
+				return fmt.Errorf("failed to use socket activation listener for %s: %v", l.Name, err)
+			}
+		}
+		if l.Listener == nil {
+			addr := net.JoinHostPort(l.BindAddress.String(), strconv.Itoa(l.BindPort))
+
+			var err error
+			l.Listener, l.BindPort, err = CreateListener("tcp", addr, net.ListenConfig{Control: s.control})
+			if err != nil {
+				return fmt.Errorf("failed to create %s listener: %v", l.Name, err)
+			}
+			if err := setBacklog(l.Listener, s.Backlog); err != nil {
+				return err
+			}
+		}
+		c.AdditionalListeners = append(c.AdditionalListeners, server.NamedListener{
+			Name:     l.Name,
+			Listener: l.Listener,
+			Routes:   l.Routes,
+		})
+	}
+
+	if len(s.CertFile) == 0 && len(s.KeyFile) == 0 {
+		return nil
+	}
+
+	cert, err := dynamiccertificates.NewDynamicServingContentFromFiles("serving-cert", s.CertFile, s.KeyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load server certificate: %v", err)
+	}
+	c.Cert = cert
+
+	c.MinTLSVersion, err = TLSVersion(s.MinTLSVersion)
+	if err != nil {
+		return err
+	}
+	c.CipherSuites, err = TLSCipherSuites(s.CipherSuites)
+	if err != nil {
+		return err
+	}
+
+	for _, nck := range s.SNICertKeys {
+		sniCert, err := dynamiccertificates.NewDynamicSNIContentFromFiles("sni-serving-cert", nck.CertFile, nck.KeyFile, nck.Names...)
+		if err != nil {
+			return fmt.Errorf("unable to load SNI certificate %q: %v", nck.CertFile, err)
+		}
+		c.SNICerts = append(c.SNICerts, sniCert)
+	}
+
+	if len(s.ClientCAFile) > 0 {
+		caBundle, err := os.ReadFile(s.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("unable to load client CA file: %v", err)
+		}
+		c.ClientCA = x509.NewCertPool()
+		if !c.ClientCA.AppendCertsFromPEM(caBundle) {
+			return fmt.Errorf("unable to load client CA file %q: no certificates found", s.ClientCAFile)
+		}
+		c.ClientCertRequired = s.ClientCertRequired
 	}
 
 	return nil
 }
 
+func (s *ServingOptions) Validate() []error {
+	if s == nil {
+		return nil
+	}
+
+	errors := []error{}
+
+	switch s.BindNetwork {
+	case "", "tcp", "tcp4", "tcp6":
+	case "unix":
+		if len(s.SocketPath) == 0 && s.Listener == nil {
+			errors = append(errors, fmt.Errorf("SocketPath is required for BindNetwork %q", s.BindNetwork))
+		}
+	default:
+		errors = append(errors, fmt.Errorf("BindNetwork %q must be one of tcp, tcp4, tcp6 or unix", s.BindNetwork))
+	}
+	if s.SocketMode&^os.ModePerm != 0 {
+		errors = append(errors, fmt.Errorf("SocketMode %v must only contain permission bits", s.SocketMode))
+	}
+
+	// BindPort is not used to serve on a unix domain socket.
+	if !s.isUnix() {
+		if s.Required && s.BindPort < 1 || s.BindPort > 65535 {
+			errors = append(errors, fmt.Errorf("BindPort %v must be between 1 and 65535, inclusive. It cannot be turned off with 0", s.BindPort))
+		} else if s.BindPort < 0 || s.BindPort > 65535 {
+			errors = append(errors, fmt.Errorf("BindPort %v must be between 0 and 65535, inclusive. 0 for turning off secure port", s.BindPort))
+		}
+	}
+
+	if s.Backlog < 0 {
+		errors = append(errors, fmt.Errorf("Backlog %v must not be negative", s.Backlog))
+	}
+	if s.TCPFastOpenQueueLength < 0 {
+		errors = append(errors, fmt.Errorf("TCPFastOpenQueueLength %v must not be negative", s.TCPFastOpenQueueLength))
+	}
+	if s.TCPUserTimeout < 0 {
+		errors = append(errors, fmt.Errorf("TCPUserTimeout %v must not be negative", s.TCPUserTimeout))
+	}
+	if !socketOptionsSupported && (s.ReusePort || s.Backlog > 0 || s.TCPFastOpenQueueLength > 0 || s.TCPUserTimeout > 0) {
+		errors = append(errors, fmt.Errorf("ReusePort, Backlog, TCPFastOpenQueueLength and TCPUserTimeout are not supported on %s", runtime.GOOS))
+	}
+
+	if s.MaxConnections < 0 {
+		errors = append(errors, fmt.Errorf("MaxConnections %v must not be negative", s.MaxConnections))
+	}
+	if s.MaxConnectionsPerIP < 0 {
+		errors = append(errors, fmt.Errorf("MaxConnectionsPerIP %v must not be negative", s.MaxConnectionsPerIP))
+	}
+	if s.MaxAcceptRate < 0 {
+		errors = append(errors, fmt.Errorf("MaxAcceptRate %v must not be negative", s.MaxAcceptRate))
+	}
+	if s.MaxAcceptBurst < 0 {
+		errors = append(errors, fmt.Errorf("MaxAcceptBurst %v must not be negative", s.MaxAcceptBurst))
+	}
+
+	if len(s.ProxyProtocol) > 0 {
+		if _, err := proxyproto.ParseMode(s.ProxyProtocol); err != nil {
+			errors = append(errors, err)
+		}
+		if len(s.ProxyProtocolTrustedCIDRs) == 0 {
+			errors = append(errors, fmt.Errorf("ProxyProtocol requires ProxyProtocolTrustedCIDRs"))
+		}
+	} else if len(s.ProxyProtocolTrustedCIDRs) > 0 {
+		errors = append(errors, fmt.Errorf("ProxyProtocolTrustedCIDRs requires ProxyProtocol"))
+	}
+	if _, err := proxyproto.ParseCIDRs(s.ProxyProtocolTrustedCIDRs); err != nil {
+		errors = append(errors, fmt.Errorf("invalid ProxyProtocolTrustedCIDRs: %v", err))
+	}
+
+	names := map[string]bool{}
+	for i, l := range s.AdditionalListeners {
+		if len(l.Name) == 0 {
+			errors = append(errors, fmt.Errorf("AdditionalListeners[%d] must have a Name", i))
+		} else if names[l.Name] {
+			errors = append(errors, fmt.Errorf("AdditionalListeners[%d] has the duplicate Name %q", i, l.Name))
+		}
+		names[l.Name] = true
+		if l.Listener == nil && (l.BindPort < 1 || l.BindPort > 65535) {
+			errors = append(errors, fmt.Errorf("AdditionalListeners[%d] BindPort %v must be between 1 and 65535, inclusive", i, l.BindPort))
+		}
+	}
+
+	if (len(s.CertFile) == 0) != (len(s.KeyFile) == 0) {
+		errors = append(errors, fmt.Errorf("CertFile and KeyFile must be specified together"))
+	}
+	if len(s.SNICertKeys) > 0 && len(s.CertFile) == 0 {
+		errors = append(errors, fmt.Errorf("SNICertKeys require CertFile and KeyFile as the default certificate"))
+	}
+	files := []string{s.CertFile, s.KeyFile, s.ClientCAFile}
+	for i, nck := range s.SNICertKeys {
+		if len(nck.CertFile) == 0 || len(nck.KeyFile) == 0 {
+			errors = append(errors, fmt.Errorf("SNICertKeys[%d] must specify CertFile and KeyFile", i))
+		}
+		files = append(files, nck.CertFile, nck.KeyFile)
+	}
+	if len(s.ClientCAFile) > 0 && len(s.CertFile) == 0 {
+		errors = append(errors, fmt.Errorf("ClientCAFile requires CertFile and KeyFile to serve https"))
+	}
+	if s.ClientCertRequired && len(s.ClientCAFile) == 0 {
+		errors = append(errors, fmt.Errorf("ClientCertRequired requires ClientCAFile"))
+	}
+	for _, file := range files {
+		if len(file) == 0 {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errors = append(errors, fmt.Errorf("unable to read %q: %v", file, err))
+		}
+	}
+
+	if _, err := TLSVersion(s.MinTLSVersion); err != nil {
+		errors = append(errors, err)
+	}
+	if _, err := TLSCipherSuites(s.CipherSuites); err != nil {
+		errors = append(errors, err)
+	}
+
+	return errors
+}
+
 func CreateListener(network, addr string, config net.ListenConfig) (net.Listener, int, error) {
 	if len(network) == 0 {
 		network = "tcp"
@@ -86,3 +450,132 @@ func CreateListener(network, addr string, config net.ListenConfig) (net.Listener
 
 	return ln, tcpAddr.Port, nil
 }
+
+// CreateUnixListener listens on the unix domain socket at path and sets its file permissions
+// to mode unless it's zero. An existing socket at path nobody is listening on is removed
+// first. The socket is removed once the listener is closed.
+func CreateUnixListener(path string, mode os.FileMode) (net.Listener, error) {
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %v: %v", path, err)
+	}
+	ln.(*net.UnixListener).SetUnlinkOnClose(true)
+
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("failed to set mode of %v: %v", path, err)
+		}
+	}
+	return ln, nil
+}
+
+// removeStaleSocket removes the unix domain socket at path if no process is listening on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%v exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("%v is in use by another process", path)
+	}
+	fmt.Printf("Removing stale socket %s\n", path)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket %v: %v", path, err)
+	}
+	return nil
+}
+
+func (s *ServingOptions) isUnix() bool {
+	return s.BindNetwork == "unix"
+}
+
+// MaybeDefaultWithSelfSignedCerts generates a self-signed CA and a serving certificate signed by it
+// for BindAddress, ExternalAddress, localhost and the given alternates if neither CertFile nor KeyFile
+// is set. They are cached in CertDirectory, the CA as <PairName>-ca.crt, and reused on later starts
+// as long as they are valid for all of those names. CertFile and KeyFile are set to the cached files.
+func (s *ServingOptions) MaybeDefaultWithSelfSignedCerts(alternateDNS []string, alternateIPs []net.IP) error {
+	if s == nil || (s.Listener == nil && s.BindPort == 0 && !s.isUnix()) {
+		return nil
+	}
+	if len(s.CertFile) != 0 || len(s.KeyFile) != 0 {
+		return nil
+	}
+
+	certFile := filepath.Join(s.CertDirectory, s.PairName+".crt")
+	keyFile := filepath.Join(s.CertDirectory, s.PairName+".key")
+	caFile := filepath.Join(s.CertDirectory, s.PairName+"-ca.crt")
+
+	alternateDNS = append([]string{"localhost"}, alternateDNS...)
+	alternateIPs = append([]net.IP{net.ParseIP("127.0.0.1")}, alternateIPs...)
+	for _, ip := range []net.IP{s.BindAddress, s.ExternalAddress} {
+		if ip != nil && !ip.IsUnspecified() {
+			alternateIPs = append(alternateIPs, ip)
+		}
+	}
+
+	if !canReuseSelfSignedCert(certFile, keyFile, alternateDNS, alternateIPs) {
+		host := "localhost"
+		if s.ExternalAddress != nil && !s.ExternalAddress.IsUnspecified() {
+			host = s.ExternalAddress.String()
+		}
+		cert, key, ca, err := certutil.GenerateSelfSignedCertKey(host, alternateIPs, alternateDNS)
+		if err != nil {
+			return fmt.Errorf("unable to generate self signed cert: %v", err)
+		}
+		if err := certutil.WriteCert(certFile, cert); err != nil {
+			return err
+		}
+		if err := certutil.WriteKey(keyFile, key); err != nil {
+			return err
+		}
+		if err := certutil.WriteCert(caFile, ca); err != nil {
+			return err
+		}
+		fmt.Printf("Generated self-signed cert (%s, %s)\n", certFile, keyFile)
+	}
+
+	s.CertFile = certFile
+	s.KeyFile = keyFile
+	return nil
+}
+
+// canReuseSelfSignedCert returns whether the cert and key files exist, match, are
+// currently valid and cover all of the given names.
+func canReuseSelfSignedCert(certFile, keyFile string, dnsNames []string, ips []net.IP) bool {
+	tlsCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return false
+	}
+	leaf, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	if err != nil {
+		return false
+	}
+	if now := time.Now(); now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+		return false
+	}
+	for _, name := range dnsNames {
+		if leaf.VerifyHostname(name) != nil {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if leaf.VerifyHostname(ip.String()) != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+//go:build linux
+
+package options
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// socketOptionsSupported is whether the listener socket options of ServingOptions are supported.
+const socketOptionsSupported = true
+
+// control sets the socket options of a tcp listener before it is bound.
+func (s *ServingOptions) control(network, address string, c syscall.RawConn) error {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil
+	}
+
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if s.ReusePort {
+			if err := unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1); err != nil {
+				sockErr = fmt.Errorf("failed to set SO_REUSEPORT: %v", err)
+				return
+			}
+		}
+		if s.TCPFastOpenQueueLength > 0 {
+			if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_FASTOPEN, s.TCPFastOpenQueueLength); err != nil {
+				sockErr = fmt.Errorf("failed to set TCP_FASTOPEN: %v", err)
+				return
+			}
+		}
+		if s.TCPUserTimeout > 0 {
+			// accepted connections inherit the timeout of the listener.
+			if err := unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, unix.TCP_USER_TIMEOUT, int(s.TCPUserTimeout.Milliseconds())); err != nil {
+				sockErr = fmt.Errorf("failed to set TCP_USER_TIMEOUT: %v", err)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// setBacklog resizes the accept queue of a tcp listener.
+func setBacklog(ln net.Listener, backlog int) error {
+	tl, ok := ln.(*net.TCPListener)
+	if !ok || backlog <= 0 {
+		return nil
+	}
+	rc, err := tl.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var listenErr error
+	// listen(2) on a listening socket only updates its backlog.
+	if err := rc.Control(func(fd uintptr) {
+		listenErr = unix.Listen(int(fd), backlog)
+	}); err != nil {
+		return err
+	}
+	if listenErr != nil {
+		return fmt.Errorf("failed to set backlog: %v", listenErr)
+	}
+	return nil
+}
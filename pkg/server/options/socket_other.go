@@ -0,0 +1,19 @@
+//go:build !linux
+
+package options
+
+import (
+	"net"
+	"syscall"
+)
+
+// socketOptionsSupported is whether the listener socket options of ServingOptions are supported.
+const socketOptionsSupported = false
+
+func (s *ServingOptions) control(network, address string, c syscall.RawConn) error {
+	return nil
+}
+
+func setBacklog(ln net.Listener, backlog int) error {
+	return nil
+}
@@ -0,0 +1,50 @@
+package options
+
+import (
+	"crypto/tls"
+	"fmt"
+)
+
+var tlsVersions = map[string]uint16{
+	"VersionTLS10": tls.VersionTLS10,
+	"VersionTLS11": tls.VersionTLS11,
+	"VersionTLS12": tls.VersionTLS12,
+	"VersionTLS13": tls.VersionTLS13,
+}
+
+// TLSVersion returns the tls package constant of the given version name.
+// An empty name returns 0, i.e. the default of the server.
+func TLSVersion(versionName string) (uint16, error) {
+	if len(versionName) == 0 {
+		return 0, nil
+	}
+	if version, ok := tlsVersions[versionName]; ok {
+		return version, nil
+	}
+	return 0, fmt.Errorf("unknown tls version %q", versionName)
+}
+
+// TLSCipherSuites returns the tls package constants of the given cipher suite names.
+func TLSCipherSuites(cipherNames []string) ([]uint16, error) {
+	if len(cipherNames) == 0 {
+		return nil, nil
+	}
+
+	ciphers := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		ciphers[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		ciphers[suite.Name] = suite.ID
+	}
+
+	ciphersIntSlice := make([]uint16, 0, len(cipherNames))
+	for _, cipher := range cipherNames {
+		intValue, ok := ciphers[cipher]
+		if !ok {
+			return nil, fmt.Errorf("cipher suite %s not supported or doesn't exist", cipher)
+		}
+		ciphersIntSlice = append(ciphersIntSlice, intValue)
+	}
+	return ciphersIntSlice, nil
+}
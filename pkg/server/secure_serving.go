@@ -2,10 +2,15 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
+	"sync"
 	"time"
 
+	"github.com/ForbiddenR/apiserver/pkg/server/dynamiccertificates"
+	"github.com/ForbiddenR/apiserver/pkg/util/connlimit"
+	"github.com/ForbiddenR/apiserver/pkg/util/proxyproto"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -21,11 +26,119 @@ func (s *ServingInfo) Serve(handler *APIServerHandler, shutdownTimeout time.Dura
 	if s.Listener == nil {
 		return nil, nil, fmt.Errorf("listener must not be nil")
 	}
-	return RunServer(handler.GoRestfulApp, s.Listener, shutdownTimeout, stopCh)
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	handler.GoRestfulApp.Server().TLSConfig = tlsConfig
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		defer cancel()
+		<-stopCh
+	}()
+	if controller, ok := s.Cert.(dynamiccertificates.ControllerRunner); ok {
+		go controller.Run(ctx)
+	}
+	for _, sniCert := range s.SNICerts {
+		if controller, ok := sniCert.(dynamiccertificates.ControllerRunner); ok {
+			go controller.Run(ctx)
+		}
+	}
+
+	listeners := append([]NamedListener{{Listener: s.Listener, Routes: s.Routes}}, s.AdditionalListeners...)
+	for i := range listeners {
+		listeners[i].Listener = tcpKeepAliveListener{
+			Listener:        listeners[i].Listener,
+			keepAlivePeriod: s.KeepAlivePeriod,
+			noDelay:         !s.DisableTCPNoDelay,
+		}
+	}
+	// the connection limits are applied on top of the PROXY protocol so that the limit per IP
+	// applies to the address of the client instead of the one of the proxy.
+	if s.ProxyProtocol != nil {
+		for i := range listeners {
+			listeners[i].Listener = proxyproto.NewListener(listeners[i].Listener, *s.ProxyProtocol)
+		}
+	}
+	if s.ConnectionLimits != nil {
+		limiters := make([]*connlimit.Listener, len(listeners))
+		for i := range listeners {
+			limiters[i] = connlimit.NewListener(listeners[i].Listener, *s.ConnectionLimits)
+			listeners[i].Listener = limiters[i]
+		}
+		s.connLimiters.Store(&limiters)
+	}
+	return runServer(handler.GoRestfulApp, listeners, shutdownTimeout, stopCh)
+}
+
+// ConnectionStats returns the counters of the ConnectionLimits summed up over all
+// listeners. It returns false if there are no ConnectionLimits or the server isn't serving yet.
+func (s *ServingInfo) ConnectionStats() (connlimit.Stats, bool) {
+	limiters := s.connLimiters.Load()
+	if limiters == nil {
+		return connlimit.Stats{}, false
+	}
+	var stats connlimit.Stats
+	for _, limiter := range *limiters {
+		listenerStats := limiter.Stats()
+		stats.Open += listenerStats.Open
+		stats.Accepted += listenerStats.Accepted
+		stats.RejectedMaxConns += listenerStats.RejectedMaxConns
+		stats.RejectedMaxConnsPerIP += listenerStats.RejectedMaxConnsPerIP
+		stats.RejectedAcceptRate += listenerStats.RejectedAcceptRate
+	}
+	return stats, true
+}
+
+// tlsConfig returns the tls.Config to serve https with or nil if no Cert is configured.
+func (s *ServingInfo) tlsConfig() (*tls.Config, error) {
+	if s.Cert == nil {
+		return nil, nil
+	}
+
+	var sniController *dynamiccertificates.SNIController
+	if len(s.SNICerts) > 0 {
+		sniController = dynamiccertificates.NewSNIController(s.SNICerts)
+	}
+
+	tlsConfig := &tls.Config{
+		// Can't use SSLv3 because of POODLE and BEAST
+		// Can't use TLSv1.0 because of POODLE and BEAST using CBC cipher
+		// Can't use TLSv1.1 because of RC4 cipher usage
+		MinVersion: tls.VersionTLS12,
+		NextProtos: s.NextProtos,
+		// the certificate is looked up on every handshake so that reloaded certificates
+		// are served without a restart.
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if sniController != nil && len(hello.ServerName) > 0 {
+				if cert := sniController.CertificateForName(hello.ServerName); cert != nil {
+					return cert, nil
+				}
+			}
+			return s.Cert.CurrentCertificate(), nil
+		},
+	}
+	if s.MinTLSVersion > 0 {
+		tlsConfig.MinVersion = s.MinTLSVersion
+	}
+	if len(s.CipherSuites) > 0 {
+		tlsConfig.CipherSuites = s.CipherSuites
+	}
+	if s.ClientCA != nil {
+		// Populate PeerCertificates in requests, but don't reject connections without certificates
+		// This allows certificates to be validated by authenticators, while still allowing other auth types
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if s.ClientCertRequired {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		tlsConfig.ClientCAs = s.ClientCA
+	}
+	return tlsConfig, nil
 }
 
 // RunServer spawns a go-routine continously serving until the stopCh is
-// closed.
+// closed. If the TLSConfig of the underlying fasthttp server is set, https is served.
 // It returns a stoppedCh that is closed when all non-hijacked active requests
 // have been processed.
 // This function does not block.
@@ -38,6 +151,29 @@ func RunServer(
 	if ln == nil {
 		return nil, nil, fmt.Errorf("listener must not be nil")
 	}
+	ln = tcpKeepAliveListener{Listener: ln, noDelay: true}
+	return runServer(server, []NamedListener{{Listener: ln}}, shutDownTimeout, stopCh)
+}
+
+// runServer serves server on all listeners like RunServer. The listenerStoppedCh
+// is closed once all of them have stopped listening. It doesn't tune the accepted
+// connections, the listeners are expected to be wrapped by tcpKeepAliveListener.
+func runServer(
+	server *fiber.App,
+	listeners []NamedListener,
+	shutDownTimeout time.Duration,
+	stopCh <-chan struct{},
+) (<-chan struct{}, <-chan struct{}, error) {
+	restrictRoutes := false
+	for _, l := range listeners {
+		if l.Listener == nil {
+			return nil, nil, fmt.Errorf("listener %q must not be nil", l.Name)
+		}
+		restrictRoutes = restrictRoutes || len(l.Routes) > 0
+	}
+	if restrictRoutes {
+		server.Server().Handler = withListenerRoutes(server.Server().Handler)
+	}
 
 	// Shutdown server gracefully.
 	serverShutdownCh, listenerStoppedCh := make(chan struct{}), make(chan struct{})
@@ -49,26 +185,48 @@ func RunServer(
 		cancel()
 	}()
 
-	go func() {
-		defer close(listenerStoppedCh)
+	var wg sync.WaitGroup
+	for _, l := range listeners {
+		wg.Add(1)
+		go func(l NamedListener) {
+			defer wg.Done()
 
-		listener := tcpKeepAliveListener{ln}
+			listener := l.Listener
+			if len(l.Routes) > 0 {
+				listener = routesListener{Listener: listener, routes: l.Routes}
+			}
+			if tlsConfig := server.Server().TLSConfig; tlsConfig != nil {
+				listener = tls.NewListener(listener, tlsConfig)
+			}
 
-		err := server.Listener(listener)
+			err := server.Listener(listener)
 
-		msg := fmt.Sprintf("Stopped listening on %s", ln.Addr().String())
-		select {
-		case <-stopCh:
-			fmt.Println(msg)
-		default:
-			panic(fmt.Sprintf("%s due to error: %v", msg, err))
-		}
+			msg := fmt.Sprintf("Stopped listening on %s", l.Listener.Addr().String())
+			if len(l.Name) > 0 {
+				msg = fmt.Sprintf("Stopped listening %s on %s", l.Name, l.Listener.Addr().String())
+			}
+			select {
+			case <-stopCh:
+				fmt.Println(msg)
+			default:
+				panic(fmt.Sprintf("%s due to error: %v", msg, err))
+			}
+		}(l)
+	}
+	go func() {
+		defer close(listenerStoppedCh)
+		wg.Wait()
 	}()
 	return serverShutdownCh, listenerStoppedCh, nil
 }
 
+// tcpKeepAliveListener sets TCP keep-alive timeouts and TCP_NODELAY on accepted connections.
+// Connections of other networks, e.g. unix domain sockets, are passed through unchanged.
 type tcpKeepAliveListener struct {
 	net.Listener
+	// keepAlivePeriod defaults to defaultKeepAlivePeriod if zero, keep-alives are disabled if negative.
+	keepAlivePeriod time.Duration
+	noDelay         bool
 }
 
 func (ln tcpKeepAliveListener) Accept() (net.Conn, error) {
@@ -77,8 +235,17 @@ func (ln tcpKeepAliveListener) Accept() (net.Conn, error) {
 		return nil, err
 	}
 	if tc, ok := c.(*net.TCPConn); ok {
-		tc.SetKeepAlive(true)
-		tc.SetKeepAlivePeriod(defaultKeepAlivePeriod)
+		switch {
+		case ln.keepAlivePeriod < 0:
+			tc.SetKeepAlive(false)
+		case ln.keepAlivePeriod == 0:
+			tc.SetKeepAlive(true)
+			tc.SetKeepAlivePeriod(defaultKeepAlivePeriod)
+		default:
+			tc.SetKeepAlive(true)
+			tc.SetKeepAlivePeriod(ln.keepAlivePeriod)
+		}
+		tc.SetNoDelay(ln.noDelay)
 	}
 	return c, nil
 }
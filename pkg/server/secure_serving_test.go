@@ -0,0 +1,67 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ForbiddenR/apiserver/pkg/util/connlimit"
+)
+
+func TestServeConnectionLimits(t *testing.T) {
+	listen := func() net.Listener {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ln
+	}
+	s := &ServingInfo{
+		Listener:            listen(),
+		AdditionalListeners: []NamedListener{{Name: "admin", Listener: listen()}},
+		ConnectionLimits:    &connlimit.Options{MaxConns: 1},
+	}
+	addresses := []string{s.Listener.Addr().String(), s.AdditionalListeners[0].Listener.Addr().String()}
+
+	stopCh := make(chan struct{})
+	stoppedCh, _, err := s.Serve(NewAPIServerHandler(), time.Second, stopCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		close(stopCh)
+		<-stoppedCh
+	}()
+
+	// every listener is limited on its own, the second connection is rejected on each.
+	for _, address := range addresses {
+		for i, wantServed := range []bool{true, false} {
+			conn, err := net.Dial("tcp", address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(time.Second))
+			if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			if served := err == nil; served != wantServed {
+				t.Errorf("connection %d to %s served = %v, want %v (error %v)", i, address, served, wantServed, err)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+
+	stats, ok := s.ConnectionStats()
+	if !ok {
+		t.Fatal("ConnectionStats() returned no stats")
+	}
+	if want := (connlimit.Stats{Open: 2, Accepted: 2, RejectedMaxConns: 2}); stats != want {
+		t.Errorf("ConnectionStats() = %+v, want %+v", stats, want)
+	}
+}
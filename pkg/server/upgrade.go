@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/ForbiddenR/apiserver/pkg/util/activation"
+)
+
+// runUpgradeHandler hands the listeners over to a new process of the server binary
+// whenever UpgradeSignal is received. The returned channel is closed once stopCh
+// is closed or an upgrade succeeded. A failed upgrade is logged and the server keeps serving.
+func (s preparedGenericAPIServer) runUpgradeHandler(stopCh <-chan struct{}) <-chan struct{} {
+	upgradedCh := make(chan struct{})
+
+	upgradeHandler := make(chan os.Signal, 1)
+	signal.Notify(upgradeHandler, s.UpgradeSignal)
+	go func() {
+		defer close(upgradedCh)
+		defer signal.Stop(upgradeHandler)
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-upgradeHandler:
+			}
+
+			process, err := activation.StartUpgrade(s.ServingInfo.handoffListeners(), s.UpgradeTimeout)
+			if err != nil {
+				fmt.Printf("Upgrade failed, continuing to serve: %v\n", err)
+				continue
+			}
+			fmt.Printf("Upgraded to process %d, shutting down\n", process.Pid)
+			return
+		}
+	}()
+
+	return upgradedCh
+}
+
+// handoffListeners returns all listeners to hand over to a new process on upgrades.
+func (s *ServingInfo) handoffListeners() []activation.Listener {
+	if s == nil || s.Listener == nil {
+		return nil
+	}
+	listeners := []activation.Listener{{Name: s.ListenerName, Listener: s.Listener}}
+	for _, l := range s.AdditionalListeners {
+		listeners = append(listeners, activation.Listener{Name: l.Name, Listener: l.Listener})
+	}
+	return listeners
+}
@@ -0,0 +1,110 @@
+// Package activation implements the receiving side of the systemd socket
+// activation protocol, see sd_listen_fds(3).
+package activation
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// listenFdsStart is the first file descriptor passed by systemd.
+	listenFdsStart = 3
+	// unknownName is the name of the file descriptors if LISTEN_FDNAMES is not set.
+	unknownName = "unknown"
+)
+
+var (
+	filesOnce sync.Once
+	filesLock sync.Mutex
+	files     []*os.File
+)
+
+// Files returns the file descriptors passed by systemd, named by LISTEN_FDNAMES. It
+// returns nil if the process was not socket activated. The environment variables are
+// unset on the first call and the file descriptors are set close-on-exec so that neither
+// is inherited by child processes, later calls return the same files.
+func Files() []*os.File {
+	filesOnce.Do(func() {
+		files = listenFiles()
+	})
+	return files
+}
+
+func listenFiles() []*os.File {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	defer os.Unsetenv(listenParentPIDEnv)
+
+	// a process started by StartUpgrade can't know its own pid in advance, it is
+	// identified by the pid of its parent instead.
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		ppid, err := strconv.Atoi(os.Getenv(listenParentPIDEnv))
+		if err != nil || ppid != os.Getppid() {
+			return nil
+		}
+	}
+	nfds, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || nfds <= 0 {
+		return nil
+	}
+	names, ok := os.LookupEnv("LISTEN_FDNAMES")
+	if !ok {
+		names = strings.Repeat(unknownName+":", nfds)
+	}
+	splitNames := strings.Split(names, ":")
+
+	result := make([]*os.File, 0, nfds)
+	for i := 0; i < nfds; i++ {
+		name := unknownName
+		if i < len(splitNames) {
+			name = splitNames[i]
+		}
+		fd := uintptr(listenFdsStart + i)
+		closeOnExec(fd)
+		result = append(result, os.NewFile(fd, name))
+	}
+	return result
+}
+
+// TakeListener returns a listener for the file descriptor passed by systemd which is
+// named name. If name is empty and no file descriptor has an empty name, the only file
+// descriptor is used if exactly one was passed without a name, i.e. without LISTEN_FDNAMES.
+// It returns nil if there is no such file descriptor. Every file descriptor is returned at
+// most once, it is closed once the listener is created.
+func TakeListener(name string) (net.Listener, error) {
+	filesLock.Lock()
+	defer filesLock.Unlock()
+
+	passed := Files()
+	i := -1
+	for j, f := range passed {
+		if f != nil && f.Name() == name {
+			i = j
+			break
+		}
+	}
+	if i < 0 && len(name) == 0 && len(passed) == 1 && passed[0] != nil && passed[0].Name() == unknownName {
+		i = 0
+	}
+	if i < 0 {
+		return nil, nil
+	}
+
+	f := passed[i]
+	passed[i] = nil
+	defer f.Close()
+
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("file descriptor %d (%s) is not a listening socket: %v", listenFdsStart+i, f.Name(), err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,197 @@
+//go:build unix
+
+package activation
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// testCaseEnv selects the case of takeListenerTests TestTakeListenerHelper runs.
+const testCaseEnv = "ACTIVATION_TEST_CASE"
+
+// takeListenerTests run in a child process of the test as the passed file descriptors
+// can only be read once per process. The parent opens a socket for every name, the
+// child gets them starting at fd 3 along with their addresses by name in addrs.
+var takeListenerTests = []struct {
+	name string
+	// fdNames are the names of the passed sockets. LISTEN_FDNAMES isn't set if unnamed is true.
+	fdNames []string
+	unnamed bool
+	// wrongPID sets LISTEN_PID to the pid of a different process.
+	wrongPID bool
+	check    func(t *testing.T, addrs map[string]string)
+}{
+	{
+		name:    "named",
+		fdNames: []string{"main", "admin"},
+		check: func(t *testing.T, addrs map[string]string) {
+			expectListener(t, "admin", addrs["admin"])
+			expectListener(t, "main", addrs["main"])
+			expectNoListener(t, "admin")
+			expectNoListener(t, "")
+		},
+	},
+	{
+		name:    "unnamed",
+		fdNames: []string{unknownName},
+		unnamed: true,
+		check: func(t *testing.T, addrs map[string]string) {
+			expectListener(t, "", addrs[unknownName])
+			expectNoListener(t, "")
+		},
+	},
+	{
+		name:    "empty name",
+		fdNames: []string{"admin", ""},
+		check: func(t *testing.T, addrs map[string]string) {
+			expectListener(t, "", addrs[""])
+			expectListener(t, "admin", addrs["admin"])
+		},
+	},
+	{
+		name:    "single named",
+		fdNames: []string{"admin"},
+		check: func(t *testing.T, addrs map[string]string) {
+			expectNoListener(t, "")
+			expectListener(t, "admin", addrs["admin"])
+		},
+	},
+	{
+		name:     "wrong pid",
+		fdNames:  []string{unknownName},
+		unnamed:  true,
+		wrongPID: true,
+		check: func(t *testing.T, addrs map[string]string) {
+			if files := Files(); files != nil {
+				t.Errorf("Files() = %v, want nil", files)
+			}
+			expectNoListener(t, "")
+		},
+	},
+	{
+		name:    "close on exec",
+		fdNames: []string{"main", "admin"},
+		check: func(t *testing.T, addrs map[string]string) {
+			for i, f := range Files() {
+				flags, err := unix.FcntlInt(f.Fd(), unix.F_GETFD, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if flags&unix.FD_CLOEXEC == 0 {
+					t.Errorf("file descriptor %d (%s) is not close-on-exec", listenFdsStart+i, f.Name())
+				}
+			}
+		},
+	},
+	{
+		name:    "environment unset",
+		fdNames: []string{"main"},
+		check: func(t *testing.T, addrs map[string]string) {
+			Files()
+			for _, env := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+				if value, ok := os.LookupEnv(env); ok {
+					t.Errorf("%s=%s is still set", env, value)
+				}
+			}
+		},
+	},
+}
+
+func expectListener(t *testing.T, name, addr string) {
+	t.Helper()
+	ln, err := TakeListener(name)
+	if err != nil {
+		t.Fatalf("TakeListener(%q) failed: %v", name, err)
+	}
+	if ln == nil {
+		t.Fatalf("TakeListener(%q) returned no listener", name)
+	}
+	defer ln.Close()
+	if got := ln.Addr().String(); got != addr {
+		t.Errorf("TakeListener(%q) listens on %s, want %s", name, got, addr)
+	}
+}
+
+func expectNoListener(t *testing.T, name string) {
+	t.Helper()
+	ln, err := TakeListener(name)
+	if err != nil {
+		t.Fatalf("TakeListener(%q) failed: %v", name, err)
+	}
+	if ln != nil {
+		ln.Close()
+		t.Errorf("TakeListener(%q) returned a listener on %s, want none", name, ln.Addr())
+	}
+}
+
+func TestTakeListener(t *testing.T) {
+	for _, tt := range takeListenerTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var files []*os.File
+			var addrs []string
+			for range tt.fdNames {
+				ln, err := net.Listen("tcp", "127.0.0.1:0")
+				if err != nil {
+					t.Fatal(err)
+				}
+				f, err := ln.(*net.TCPListener).File()
+				ln.Close()
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				files = append(files, f)
+				addrs = append(addrs, ln.Addr().String())
+			}
+
+			cmd := exec.Command(os.Args[0], "-test.run=^TestTakeListenerHelper$", "-test.v")
+			cmd.ExtraFiles = files
+			cmd.Env = append(os.Environ(),
+				testCaseEnv+"="+tt.name,
+				"TEST_ADDRS="+strings.Join(addrs, ","),
+				"LISTEN_FDS="+strconv.Itoa(len(files)),
+			)
+			if !tt.unnamed {
+				cmd.Env = append(cmd.Env, "LISTEN_FDNAMES="+strings.Join(tt.fdNames, ":"))
+			}
+			if tt.wrongPID {
+				cmd.Env = append(cmd.Env, "LISTEN_PID="+strconv.Itoa(os.Getpid()))
+			}
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+		})
+	}
+}
+
+// TestTakeListenerHelper runs a case of takeListenerTests in the child process
+// started by TestTakeListener.
+func TestTakeListenerHelper(t *testing.T) {
+	name := os.Getenv(testCaseEnv)
+	if len(name) == 0 {
+		t.Skip("only runs as a child process of TestTakeListener")
+	}
+	for _, tt := range takeListenerTests {
+		if tt.name != name {
+			continue
+		}
+		// systemd sets LISTEN_PID to the pid of the activated process.
+		if !tt.wrongPID {
+			os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+		}
+		addrs := map[string]string{}
+		for i, addr := range strings.Split(os.Getenv("TEST_ADDRS"), ",") {
+			addrs[tt.fdNames[i]] = addr
+		}
+		tt.check(t, addrs)
+		return
+	}
+	t.Fatalf("unknown test case %q", name)
+}
@@ -0,0 +1,9 @@
+//go:build unix
+
+package activation
+
+import "syscall"
+
+func closeOnExec(fd uintptr) {
+	syscall.CloseOnExec(int(fd))
+}
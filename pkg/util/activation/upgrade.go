@@ -0,0 +1,147 @@
+package activation
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// listenParentPIDEnv identifies the process started by StartUpgrade by the pid of its parent.
+	listenParentPIDEnv = "LISTEN_PARENT_PID"
+	// readyFDEnv is the file descriptor NotifyReady reports readiness on to the parent.
+	readyFDEnv = "LISTEN_READY_FD"
+)
+
+// Listener is a listener handed over to a new process by StartUpgrade.
+type Listener struct {
+	// Name is the name of the file descriptor in LISTEN_FDNAMES, the new process
+	// gets the listener from TakeListener(Name).
+	Name     string
+	Listener net.Listener
+}
+
+// StartUpgrade starts the executable of the process again with the same arguments and passes it
+// the listeners like systemd socket activation does. It waits until the new process reports
+// ready through NotifyReady. It fails if the new process exits before or doesn't report ready
+// within timeout, in which case the new process is killed.
+// Unix domain sockets are not removed anymore when the listeners are closed once the upgrade succeeded.
+func StartUpgrade(listeners []Listener, timeout time.Duration) (*os.Process, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, l := range listeners {
+		if strings.Contains(l.Name, ":") {
+			return nil, fmt.Errorf("listener name %q must not contain ':'", l.Name)
+		}
+		filer, ok := l.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("listener %q of type %T can't be handed over", l.Name, l.Listener)
+		}
+		f, err := filer.File()
+		if err != nil {
+			return nil, fmt.Errorf("unable to get file descriptor of listener %q: %v", l.Name, err)
+		}
+		names = append(names, l.Name)
+		files = append(files, f)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer readyR.Close()
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(append([]*os.File{}, files...), readyW)
+	for _, env := range os.Environ() {
+		switch strings.SplitN(env, "=", 2)[0] {
+		case "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES", listenParentPIDEnv, readyFDEnv:
+			continue
+		}
+		cmd.Env = append(cmd.Env, env)
+	}
+	cmd.Env = append(cmd.Env,
+		"LISTEN_FDS="+strconv.Itoa(len(files)),
+		"LISTEN_FDNAMES="+strings.Join(names, ":"),
+		listenParentPIDEnv+"="+strconv.Itoa(os.Getpid()),
+		readyFDEnv+"="+strconv.Itoa(listenFdsStart+len(files)),
+	)
+
+	err = cmd.Start()
+	readyW.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// the read returns once the new process reported ready or exited.
+	readyCh := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1)
+		if _, err := readyR.Read(buf); err != nil {
+			readyCh <- fmt.Errorf("new process exited before it was ready")
+			return
+		}
+		readyCh <- nil
+	}()
+
+	select {
+	case err = <-readyCh:
+	case <-time.After(timeout):
+		err = fmt.Errorf("new process not ready after %v", timeout)
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		go cmd.Wait()
+		return nil, err
+	}
+	// reap the new process in case this one outlives it.
+	go cmd.Wait()
+
+	for _, l := range listeners {
+		if ul, ok := l.Listener.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+	}
+	return cmd.Process, nil
+}
+
+var notifyReadyOnce sync.Once
+
+// NotifyReady reports to the process which started this one through StartUpgrade that it
+// is ready to serve. It does nothing if this process was not started by StartUpgrade.
+func NotifyReady() error {
+	var err error
+	notifyReadyOnce.Do(func() {
+		fdEnv, ok := os.LookupEnv(readyFDEnv)
+		if !ok {
+			return
+		}
+		os.Unsetenv(readyFDEnv)
+
+		fd, parseErr := strconv.Atoi(fdEnv)
+		if parseErr != nil {
+			err = fmt.Errorf("invalid %s %q: %v", readyFDEnv, fdEnv, parseErr)
+			return
+		}
+		f := os.NewFile(uintptr(fd), "ready")
+		defer f.Close()
+		_, err = f.Write([]byte{1})
+	})
+	return err
+}
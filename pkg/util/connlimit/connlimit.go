@@ -0,0 +1,215 @@
+// Package connlimit limits the connections a listener accepts.
+package connlimit
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ForbiddenR/apiserver/pkg/util/flowcontrol"
+)
+
+// Options are the limits of a Listener. Zero disables a limit.
+type Options struct {
+	// MaxConns is the maximum number of concurrently open connections.
+	MaxConns int
+	// MaxConnsPerIP is the maximum number of concurrently open connections of a remote IP.
+	MaxConnsPerIP int
+	// AcceptRate is the maximum number of connections accepted per second on average.
+	AcceptRate float64
+	// AcceptBurst is the number of connections accepted at once beyond AcceptRate.
+	// It is at least 1.
+	AcceptBurst int
+}
+
+// Stats are the counters of a Listener.
+type Stats struct {
+	// Open is the number of currently open connections.
+	Open int64
+	// Accepted is the total number of connections accepted within MaxConns and AcceptRate,
+	// including the ones closed later on because of MaxConnsPerIP.
+	Accepted uint64
+	// RejectedMaxConns is the total number of connections closed because of MaxConns.
+	RejectedMaxConns uint64
+	// RejectedMaxConnsPerIP is the total number of connections closed because of MaxConnsPerIP.
+	RejectedMaxConnsPerIP uint64
+	// RejectedAcceptRate is the total number of connections closed because of AcceptRate.
+	RejectedAcceptRate uint64
+}
+
+// Listener closes the connections exceeding its limits right after accepting them.
+// The limit per IP is only checked on the first Read, Write or RemoteAddr call of a
+// connection as the remote address of a wrapped connection may be resolved lazily, e.g.
+// from a PROXY protocol header, and resolving it must not block accepting other connections.
+type Listener struct {
+	net.Listener
+	options Options
+	limiter *flowcontrol.TokenBucket
+
+	lock  sync.Mutex
+	open  int64
+	perIP map[string]int
+
+	accepted              atomic.Uint64
+	rejectedMaxConns      atomic.Uint64
+	rejectedMaxConnsPerIP atomic.Uint64
+	rejectedAcceptRate    atomic.Uint64
+}
+
+// NewListener wraps ln to enforce the limits of options.
+func NewListener(ln net.Listener, options Options) *Listener {
+	l := &Listener{
+		Listener: ln,
+		options:  options,
+		perIP:    map[string]int{},
+	}
+	if options.AcceptRate > 0 {
+		l.limiter = flowcontrol.NewTokenBucket(options.AcceptRate, options.AcceptBurst)
+	}
+	return l
+}
+
+// Accept waits for the next connection within the limits.
+func (l *Listener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if conn := l.admit(c); conn != nil {
+			return conn, nil
+		}
+		c.Close()
+	}
+}
+
+// admit accounts c and returns it wrapped, or nil if it exceeds a global limit.
+func (l *Listener) admit(c net.Conn) net.Conn {
+	if l.limiter != nil && !l.limiter.TryAccept() {
+		l.rejectedAcceptRate.Add(1)
+		return nil
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.options.MaxConns > 0 && l.open >= int64(l.options.MaxConns) {
+		l.rejectedMaxConns.Add(1)
+		return nil
+	}
+	l.open++
+	l.accepted.Add(1)
+	return &conn{Conn: c, listener: l}
+}
+
+// admitIP accounts a connection of ip and returns false if it exceeds the limit per IP.
+func (l *Listener) admitIP(ip string) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.options.MaxConnsPerIP > 0 && l.perIP[ip] >= l.options.MaxConnsPerIP {
+		l.rejectedMaxConnsPerIP.Add(1)
+		return false
+	}
+	l.perIP[ip]++
+	return true
+}
+
+func (l *Listener) release(ip string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.open--
+	if len(ip) == 0 {
+		return
+	}
+	if l.perIP[ip]--; l.perIP[ip] <= 0 {
+		delete(l.perIP, ip)
+	}
+}
+
+// Stats returns the current counters.
+func (l *Listener) Stats() Stats {
+	l.lock.Lock()
+	open := l.open
+	l.lock.Unlock()
+
+	return Stats{
+		Open:                  open,
+		Accepted:              l.accepted.Load(),
+		RejectedMaxConns:      l.rejectedMaxConns.Load(),
+		RejectedMaxConnsPerIP: l.rejectedMaxConnsPerIP.Load(),
+		RejectedAcceptRate:    l.rejectedAcceptRate.Load(),
+	}
+}
+
+// remoteIP returns the IP of a tcp connection, connections of other networks
+// are only subject to the global limits.
+func remoteIP(c net.Conn) string {
+	if addr, ok := c.RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+	return ""
+}
+
+type conn struct {
+	net.Conn
+	listener *Listener
+
+	admitOnce sync.Once
+	// ip is the remote IP accounted against the limit per IP, empty if it isn't.
+	ip        string
+	admitErr  error
+	closeOnce sync.Once
+}
+
+// admit checks the limit per IP, it closes the connection if it is exceeded.
+func (c *conn) admit() {
+	ip := remoteIP(c.Conn)
+	if len(ip) == 0 {
+		return
+	}
+	if !c.listener.admitIP(ip) {
+		c.admitErr = fmt.Errorf("too many connections from %s", ip)
+		c.Conn.Close()
+		return
+	}
+	c.ip = ip
+}
+
+// NetConn returns the underlying connection.
+func (c *conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *conn) Read(b []byte) (int, error) {
+	c.admitOnce.Do(c.admit)
+	if c.admitErr != nil {
+		return 0, c.admitErr
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *conn) Write(b []byte) (int, error) {
+	c.admitOnce.Do(c.admit)
+	if c.admitErr != nil {
+		return 0, c.admitErr
+	}
+	return c.Conn.Write(b)
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	c.admitOnce.Do(c.admit)
+	return c.Conn.RemoteAddr()
+}
+
+func (c *conn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		// the IP must not be accounted once the connection is released.
+		c.admitOnce.Do(func() {})
+		c.listener.release(c.ip)
+	})
+	return err
+}
@@ -0,0 +1,211 @@
+package connlimit
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errNoConn = errors.New("no pending connection")
+
+// fakeListener accepts its pending connections, Accept fails once there are none.
+type fakeListener struct {
+	pending []net.Conn
+}
+
+func (l *fakeListener) Accept() (net.Conn, error) {
+	if len(l.pending) == 0 {
+		return nil, errNoConn
+	}
+	c := l.pending[0]
+	l.pending = l.pending[1:]
+	return c, nil
+}
+
+func (l *fakeListener) Close() error {
+	return nil
+}
+
+func (l *fakeListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 443}
+}
+
+type fakeConn struct {
+	remoteAddr net.Addr
+	closed     atomic.Bool
+}
+
+func newFakeConn(ip string) *fakeConn {
+	return &fakeConn{remoteAddr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 50000}}
+}
+
+func (c *fakeConn) Read(b []byte) (int, error)         { return len(b), nil }
+func (c *fakeConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (c *fakeConn) Close() error                       { c.closed.Store(true); return nil }
+func (c *fakeConn) LocalAddr() net.Addr                { return nil }
+func (c *fakeConn) RemoteAddr() net.Addr               { return c.remoteAddr }
+func (c *fakeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// accept hands c to l and returns the connection accepted by l or the error of Accept.
+func accept(l *Listener, c net.Conn) (net.Conn, error) {
+	l.Listener.(*fakeListener).pending = append(l.Listener.(*fakeListener).pending, c)
+	return l.Accept()
+}
+
+func newListener(options Options) *Listener {
+	return NewListener(&fakeListener{}, options)
+}
+
+func checkStats(t *testing.T, l *Listener, want Stats) {
+	t.Helper()
+	if got := l.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMaxConns(t *testing.T) {
+	l := newListener(Options{MaxConns: 2})
+
+	first, err := accept(l, newFakeConn("10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := accept(l, newFakeConn("10.0.0.2")); err != nil {
+		t.Fatal(err)
+	}
+	rejected := newFakeConn("10.0.0.3")
+	if _, err := accept(l, rejected); err != errNoConn {
+		t.Fatalf("Accept() error = %v, want the connection to be rejected", err)
+	}
+	if !rejected.closed.Load() {
+		t.Error("the rejected connection was not closed")
+	}
+	checkStats(t, l, Stats{Open: 2, Accepted: 2, RejectedMaxConns: 1})
+
+	// closing a connection twice releases it once.
+	first.Close()
+	first.Close()
+	checkStats(t, l, Stats{Open: 1, Accepted: 2, RejectedMaxConns: 1})
+	if _, err := accept(l, newFakeConn("10.0.0.3")); err != nil {
+		t.Fatalf("Accept() after a release error = %v", err)
+	}
+	checkStats(t, l, Stats{Open: 2, Accepted: 3, RejectedMaxConns: 1})
+}
+
+func TestMaxConnsPerIP(t *testing.T) {
+	l := newListener(Options{MaxConnsPerIP: 1})
+
+	// the limit per IP is checked lazily, all connections are accepted.
+	first, err := accept(l, newFakeConn("10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	underlying := newFakeConn("10.0.0.1")
+	second, err := accept(l, underlying)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := accept(l, newFakeConn("10.0.0.2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStats(t, l, Stats{Open: 3, Accepted: 3})
+
+	if _, err := first.Read(make([]byte, 1)); err != nil {
+		t.Errorf("Read() of the first connection of an IP error = %v", err)
+	}
+	if _, err := second.Read(make([]byte, 1)); err == nil || !strings.Contains(err.Error(), "too many connections from 10.0.0.1") {
+		t.Errorf("Read() of the second connection of an IP error = %v, want too many connections", err)
+	}
+	if _, err := second.Write(make([]byte, 1)); err == nil {
+		t.Error("Write() of the rejected connection succeeded")
+	}
+	if !underlying.closed.Load() {
+		t.Error("the rejected connection was not closed")
+	}
+	if _, err := other.Write(make([]byte, 1)); err != nil {
+		t.Errorf("Write() of the connection of another IP error = %v", err)
+	}
+	checkStats(t, l, Stats{Open: 3, Accepted: 3, RejectedMaxConnsPerIP: 1})
+
+	// the rejected connection is released on Close, like the others.
+	second.Close()
+	checkStats(t, l, Stats{Open: 2, Accepted: 3, RejectedMaxConnsPerIP: 1})
+
+	// the IP is released on Close.
+	first.Close()
+	third, err := accept(l, newFakeConn("10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := third.RemoteAddr().String(); addr != "10.0.0.1:50000" {
+		t.Errorf("RemoteAddr() = %q, want 10.0.0.1:50000", addr)
+	}
+	if _, err := third.Read(make([]byte, 1)); err != nil {
+		t.Errorf("Read() after the IP was released error = %v", err)
+	}
+	checkStats(t, l, Stats{Open: 2, Accepted: 4, RejectedMaxConnsPerIP: 1})
+}
+
+func TestMaxConnsPerIPClosedBeforeAdmitted(t *testing.T) {
+	l := newListener(Options{MaxConnsPerIP: 1})
+
+	// a connection closed before its first use was never accounted against its IP.
+	unused, err := accept(l, newFakeConn("10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unused.Close()
+	if _, err := unused.Read(make([]byte, 1)); err != nil {
+		t.Errorf("Read() of a closed connection error = %v, want the one of the underlying connection", err)
+	}
+
+	c, err := accept(l, newFakeConn("10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Read(make([]byte, 1)); err != nil {
+		t.Errorf("Read() error = %v", err)
+	}
+	checkStats(t, l, Stats{Open: 1, Accepted: 2})
+}
+
+func TestMaxConnsPerIPOtherNetworks(t *testing.T) {
+	l := newListener(Options{MaxConnsPerIP: 1})
+
+	for i := 0; i < 3; i++ {
+		c, err := accept(l, &fakeConn{remoteAddr: &net.UnixAddr{Name: "@", Net: "unix"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Read(make([]byte, 1)); err != nil {
+			t.Errorf("Read() of unix connection %d error = %v", i, err)
+		}
+	}
+	checkStats(t, l, Stats{Open: 3, Accepted: 3})
+}
+
+func TestAcceptRate(t *testing.T) {
+	// the bucket doesn't refill noticeably while the test runs.
+	l := newListener(Options{AcceptRate: 0.001, AcceptBurst: 2})
+
+	for i := 0; i < 2; i++ {
+		if _, err := accept(l, newFakeConn("10.0.0.1")); err != nil {
+			t.Fatalf("Accept() within the burst error = %v", err)
+		}
+	}
+	rejected := newFakeConn("10.0.0.1")
+	if _, err := accept(l, rejected); err != errNoConn {
+		t.Fatalf("Accept() error = %v, want the connection to be rejected", err)
+	}
+	if !rejected.closed.Load() {
+		t.Error("the rejected connection was not closed")
+	}
+	checkStats(t, l, Stats{Open: 2, Accepted: 2, RejectedAcceptRate: 1})
+}
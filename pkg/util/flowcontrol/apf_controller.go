@@ -0,0 +1,298 @@
+package flowcontrol
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Controller admits requests like the API Priority and Fairness of Kubernetes: every
+// request is classified by the flow schemas into a priority level and a flow, the priority
+// levels share the server concurrency limit and queue the requests beyond their share.
+// Flows are shuffle-sharded to the queues so that a single flow can't block the others,
+// the queues of a priority level are served round robin.
+type Controller struct {
+	queueWaitTimeout time.Duration
+	flowSchemas      []FlowSchema
+	priorityLevels   map[string]*priorityLevel
+	// levelNames are the names of the priority levels in the order they were configured.
+	levelNames []string
+}
+
+// New returns a Controller sharing serverConcurrencyLimit between the priority levels.
+// Queued requests are rejected once they waited for queueWaitTimeout.
+func New(serverConcurrencyLimit int, queueWaitTimeout time.Duration, levels []PriorityLevelConfiguration, schemas []FlowSchema) (*Controller, error) {
+	if serverConcurrencyLimit <= 0 {
+		return nil, fmt.Errorf("server concurrency limit %d must be positive", serverConcurrencyLimit)
+	}
+	if queueWaitTimeout <= 0 {
+		return nil, fmt.Errorf("queue wait timeout %v must be positive", queueWaitTimeout)
+	}
+
+	c := &Controller{
+		queueWaitTimeout: queueWaitTimeout,
+		priorityLevels:   map[string]*priorityLevel{},
+	}
+
+	totalShares := 0
+	for _, level := range levels {
+		if len(level.Name) == 0 {
+			return nil, fmt.Errorf("priority level must have a name")
+		}
+		if _, exists := c.priorityLevels[level.Name]; exists {
+			return nil, fmt.Errorf("priority level %q is configured twice", level.Name)
+		}
+		if !level.Exempt {
+			if level.ConcurrencyShares <= 0 {
+				return nil, fmt.Errorf("priority level %q: ConcurrencyShares must be positive", level.Name)
+			}
+			if level.Queues < 0 {
+				return nil, fmt.Errorf("priority level %q: Queues must not be negative", level.Name)
+			}
+			if level.Queues > 0 {
+				if err := validateShuffleSharding(level.Queues, level.HandSize); err != nil {
+					return nil, fmt.Errorf("priority level %q: %v", level.Name, err)
+				}
+				if level.QueueLengthLimit <= 0 {
+					return nil, fmt.Errorf("priority level %q: QueueLengthLimit must be positive", level.Name)
+				}
+			}
+			totalShares += level.ConcurrencyShares
+		}
+		c.priorityLevels[level.Name] = &priorityLevel{config: level}
+		c.levelNames = append(c.levelNames, level.Name)
+	}
+	for _, level := range c.priorityLevels {
+		if level.config.Exempt {
+			continue
+		}
+		level.concurrencyLimit = int(math.Ceil(float64(serverConcurrencyLimit) * float64(level.config.ConcurrencyShares) / float64(totalShares)))
+		level.queues = make([]*queue, level.config.Queues)
+		for i := range level.queues {
+			level.queues[i] = &queue{}
+		}
+	}
+
+	names := map[string]bool{}
+	for _, schema := range schemas {
+		if len(schema.Name) == 0 {
+			return nil, fmt.Errorf("flow schema must have a name")
+		}
+		if names[schema.Name] {
+			return nil, fmt.Errorf("flow schema %q is configured twice", schema.Name)
+		}
+		names[schema.Name] = true
+		if _, ok := c.priorityLevels[schema.PriorityLevel]; !ok {
+			return nil, fmt.Errorf("flow schema %q refers to the unknown priority level %q", schema.Name, schema.PriorityLevel)
+		}
+	}
+	c.flowSchemas = append([]FlowSchema{}, schemas...)
+	sort.SliceStable(c.flowSchemas, func(i, j int) bool {
+		return c.flowSchemas[i].MatchingPrecedence < c.flowSchemas[j].MatchingPrecedence
+	})
+
+	return c, nil
+}
+
+// Handle runs execute once the request got a seat of its priority level. It returns false
+// without running execute if the request was rejected, because no flow schema matches it,
+// its queue is full, or it waited for longer than the queue wait timeout or until ctx was done.
+func (c *Controller) Handle(ctx context.Context, digest *RequestDigest, execute func()) bool {
+	schema, ok := c.classify(digest)
+	if !ok {
+		return false
+	}
+	level := c.priorityLevels[schema.PriorityLevel]
+	if level.config.Exempt {
+		level.executeExempt(execute)
+		return true
+	}
+
+	flow := schema.Name
+	if schema.FlowDistinguisher != nil {
+		flow += "/" + schema.FlowDistinguisher(digest)
+	}
+	return level.handle(ctx, flow, c.queueWaitTimeout, execute)
+}
+
+// classify returns the first flow schema matching the request.
+func (c *Controller) classify(digest *RequestDigest) (FlowSchema, bool) {
+	for _, schema := range c.flowSchemas {
+		if schema.Matches == nil || schema.Matches(digest) {
+			return schema, true
+		}
+	}
+	return FlowSchema{}, false
+}
+
+// priorityLevel is the state of a priority level.
+type priorityLevel struct {
+	config           PriorityLevelConfiguration
+	concurrencyLimit int
+
+	lock      sync.Mutex
+	queues    []*queue
+	executing int
+	// nextQueue is the queue the round robin dispatching continues with.
+	nextQueue int
+
+	dispatched uint64
+	rejected   uint64
+	timedOut   uint64
+}
+
+// queue holds the waiting requests of the flows shuffle-sharded to it.
+type queue struct {
+	waiting   []*waitingRequest
+	executing int
+}
+
+type waitingRequest struct {
+	flow    string
+	arrived time.Time
+	queue   *queue
+	// dispatchedCh is closed once the request got a seat.
+	dispatchedCh chan struct{}
+	dispatched   bool
+}
+
+func (l *priorityLevel) executeExempt(execute func()) {
+	l.lock.Lock()
+	l.executing++
+	l.dispatched++
+	l.lock.Unlock()
+
+	defer func() {
+		l.lock.Lock()
+		l.executing--
+		l.lock.Unlock()
+	}()
+	execute()
+}
+
+func (l *priorityLevel) handle(ctx context.Context, flow string, queueWaitTimeout time.Duration, execute func()) bool {
+	l.lock.Lock()
+	if l.executing < l.concurrencyLimit && l.waitingLocked() == 0 {
+		// nobody waits for a seat, so the request gets one right away.
+		q := l.chooseQueueLocked(flow)
+		l.startLocked(q)
+		l.lock.Unlock()
+		l.run(q, execute)
+		return true
+	}
+	if len(l.queues) == 0 {
+		l.rejected++
+		l.lock.Unlock()
+		return false
+	}
+	q := l.chooseQueueLocked(flow)
+	if len(q.waiting) >= l.config.QueueLengthLimit {
+		l.rejected++
+		l.lock.Unlock()
+		return false
+	}
+	req := &waitingRequest{flow: flow, arrived: time.Now(), queue: q, dispatchedCh: make(chan struct{})}
+	q.waiting = append(q.waiting, req)
+	l.lock.Unlock()
+
+	timer := time.NewTimer(queueWaitTimeout)
+	defer timer.Stop()
+	select {
+	case <-req.dispatchedCh:
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+
+	l.lock.Lock()
+	if !req.dispatched {
+		q.remove(req)
+		l.timedOut++
+		l.lock.Unlock()
+		return false
+	}
+	l.lock.Unlock()
+
+	l.run(q, execute)
+	return true
+}
+
+// run executes the request holding a seat of q and releases it afterwards.
+func (l *priorityLevel) run(q *queue, execute func()) {
+	defer func() {
+		l.lock.Lock()
+		defer l.lock.Unlock()
+		l.executing--
+		if q != nil {
+			q.executing--
+		}
+		l.dispatchLocked()
+	}()
+	execute()
+}
+
+// startLocked takes a seat for a request of q.
+func (l *priorityLevel) startLocked(q *queue) {
+	l.executing++
+	l.dispatched++
+	if q != nil {
+		q.executing++
+	}
+}
+
+// dispatchLocked gives the free seats to the waiting requests, visiting the queues round robin.
+func (l *priorityLevel) dispatchLocked() {
+	for l.executing < l.concurrencyLimit {
+		var q *queue
+		for i := range l.queues {
+			candidate := l.queues[(l.nextQueue+i)%len(l.queues)]
+			if len(candidate.waiting) > 0 {
+				q = candidate
+				l.nextQueue = (l.nextQueue + i + 1) % len(l.queues)
+				break
+			}
+		}
+		if q == nil {
+			return
+		}
+		req := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		req.dispatched = true
+		l.startLocked(q)
+		close(req.dispatchedCh)
+	}
+}
+
+// chooseQueueLocked returns the shortest queue of the hand of flow, nil if the priority level has no queues.
+func (l *priorityLevel) chooseQueueLocked(flow string) *queue {
+	if len(l.queues) == 0 {
+		return nil
+	}
+	var best *queue
+	for _, i := range dealHand(hashFlow(flow), len(l.queues), l.config.HandSize) {
+		q := l.queues[i]
+		if best == nil || len(q.waiting)+q.executing < len(best.waiting)+best.executing {
+			best = q
+		}
+	}
+	return best
+}
+
+func (l *priorityLevel) waitingLocked() int {
+	waiting := 0
+	for _, q := range l.queues {
+		waiting += len(q.waiting)
+	}
+	return waiting
+}
+
+func (q *queue) remove(req *waitingRequest) {
+	for i, r := range q.waiting {
+		if r == req {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return
+		}
+	}
+}
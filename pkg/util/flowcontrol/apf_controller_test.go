@@ -0,0 +1,292 @@
+package flowcontrol
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ForbiddenR/apiserver/pkg/authentication/user"
+)
+
+// newTestController returns a controller with a single seat for the priority level "test",
+// whose flows are the paths of the requests, and the exempt level of DefaultPriorityLevels.
+func newTestController(t *testing.T, queueWaitTimeout time.Duration, queues, handSize, queueLengthLimit int) *Controller {
+	t.Helper()
+	levels := []PriorityLevelConfiguration{
+		{Name: "exempt", Exempt: true},
+		{Name: "test", ConcurrencyShares: 1, Queues: queues, HandSize: handSize, QueueLengthLimit: queueLengthLimit},
+	}
+	schemas := []FlowSchema{
+		{Name: "exempt", PriorityLevel: "exempt", MatchingPrecedence: 1, Matches: MatchGroups(user.SystemPrivilegedGroup)},
+		{Name: "test", PriorityLevel: "test", MatchingPrecedence: 100, Matches: MatchPathPrefixes("/"), FlowDistinguisher: FlowByRoute},
+	}
+	c, err := New(1, queueWaitTimeout, levels, schemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// levelState returns the state of the priority level name.
+func levelState(c *Controller, name string) PriorityLevelState {
+	for _, state := range c.Dump() {
+		if state.Name == name {
+			return state
+		}
+	}
+	return PriorityLevelState{}
+}
+
+// waitForWaiting polls until want requests of the level "test" are waiting.
+func waitForWaiting(t *testing.T, c *Controller, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for levelState(c, "test").Waiting != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d waiting requests", want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// occupy takes the seat of the level "test" with a request of path until release is closed.
+// The result of Handle is sent to done.
+func occupy(c *Controller, path string, release <-chan struct{}, done chan<- bool) {
+	executing := make(chan struct{})
+	go func() {
+		done <- c.Handle(context.Background(), &RequestDigest{Path: path}, func() {
+			close(executing)
+			<-release
+		})
+	}()
+	<-executing
+}
+
+// enqueue sends a request of path which appends path to executed once it gets a seat.
+func enqueue(c *Controller, ctx context.Context, path string, lock *sync.Mutex, executed *[]string, done chan<- bool) {
+	go func() {
+		done <- c.Handle(ctx, &RequestDigest{Path: path}, func() {
+			lock.Lock()
+			defer lock.Unlock()
+			*executed = append(*executed, path)
+		})
+	}()
+}
+
+func TestHandleQueueLengthLimit(t *testing.T) {
+	c := newTestController(t, time.Minute, 1, 1, 1)
+	release, done := make(chan struct{}), make(chan bool, 3)
+	occupy(c, "/a", release, done)
+
+	var lock sync.Mutex
+	var executed []string
+	enqueue(c, context.Background(), "/b", &lock, &executed, done)
+	waitForWaiting(t, c, 1)
+
+	// the only queue is full.
+	if c.Handle(context.Background(), &RequestDigest{Path: "/c"}, func() { t.Error("the rejected request was executed") }) {
+		t.Error("Handle() = true for a request beyond the queue length limit")
+	}
+
+	state := levelState(c, "test")
+	state.Queues[0].Waiting[0].WaitingFor = ""
+	want := PriorityLevelState{
+		Name:             "test",
+		ConcurrencyLimit: 1,
+		Executing:        1,
+		Waiting:          1,
+		Dispatched:       1,
+		Rejected:         1,
+		Queues: []QueueState{
+			{Index: 0, Executing: 1, Waiting: []RequestState{{Flow: "test//b"}}},
+		},
+	}
+	if !reflect.DeepEqual(state, want) {
+		t.Errorf("Dump() = %+v, want %+v", state, want)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		if !<-done {
+			t.Error("Handle() = false for an admitted request")
+		}
+	}
+	if !reflect.DeepEqual(executed, []string{"/b"}) {
+		t.Errorf("executed %v, want the queued request", executed)
+	}
+	if state := levelState(c, "test"); state.Executing != 0 || state.Waiting != 0 || state.Dispatched != 2 {
+		t.Errorf("Dump() after the requests = %+v, want 2 dispatched and none executing or waiting", state)
+	}
+}
+
+func TestHandleWithoutQueues(t *testing.T) {
+	c := newTestController(t, time.Minute, 0, 0, 0)
+	release, done := make(chan struct{}), make(chan bool, 1)
+	occupy(c, "/a", release, done)
+	defer close(release)
+
+	if c.Handle(context.Background(), &RequestDigest{Path: "/b"}, func() { t.Error("the rejected request was executed") }) {
+		t.Error("Handle() = true for a request beyond the concurrency limit of a level without queues")
+	}
+	if state := levelState(c, "test"); state.Rejected != 1 {
+		t.Errorf("Dump() = %+v, want 1 rejected", state)
+	}
+}
+
+func TestHandleQueueWaitTimeout(t *testing.T) {
+	const queueWaitTimeout = 50 * time.Millisecond
+	c := newTestController(t, queueWaitTimeout, 1, 1, 10)
+	release, done := make(chan struct{}), make(chan bool, 1)
+	occupy(c, "/a", release, done)
+	defer close(release)
+
+	start := time.Now()
+	if c.Handle(context.Background(), &RequestDigest{Path: "/b"}, func() { t.Error("the timed out request was executed") }) {
+		t.Error("Handle() = true for a request which waited for longer than the queue wait timeout")
+	}
+	if elapsed := time.Since(start); elapsed < queueWaitTimeout || elapsed > 10*queueWaitTimeout {
+		t.Errorf("Handle() returned after %v, want after %v", elapsed, queueWaitTimeout)
+	}
+	if state := levelState(c, "test"); state.TimedOut != 1 || state.Waiting != 0 {
+		t.Errorf("Dump() = %+v, want 1 timed out and none waiting", state)
+	}
+}
+
+func TestHandleContextDone(t *testing.T) {
+	c := newTestController(t, time.Minute, 1, 1, 10)
+	release, done := make(chan struct{}), make(chan bool, 1)
+	occupy(c, "/a", release, done)
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if c.Handle(ctx, &RequestDigest{Path: "/b"}, func() { t.Error("the cancelled request was executed") }) {
+		t.Error("Handle() = true for a request whose context is done")
+	}
+	if state := levelState(c, "test"); state.TimedOut != 1 || state.Waiting != 0 {
+		t.Errorf("Dump() = %+v, want 1 timed out and none waiting", state)
+	}
+}
+
+func TestHandleRoundRobin(t *testing.T) {
+	const queues = 4
+	c := newTestController(t, time.Minute, queues, 1, 10)
+
+	// find two flows of different queues, the one of the lower queue index first.
+	queueOf := func(path string) int {
+		return dealHand(hashFlow("test/"+path), queues, 1)[0]
+	}
+	first, second := "/flow-0", ""
+	for i := 1; len(second) == 0; i++ {
+		path := "/flow-" + strconv.Itoa(i)
+		if queueOf(path) != queueOf(first) {
+			second = path
+		}
+	}
+	if queueOf(first) > queueOf(second) {
+		first, second = second, first
+	}
+
+	release, done := make(chan struct{}), make(chan bool, 4)
+	occupy(c, "/a", release, done)
+
+	var lock sync.Mutex
+	var executed []string
+	for i, path := range []string{first, first, second} {
+		enqueue(c, context.Background(), path, &lock, &executed, done)
+		waitForWaiting(t, c, i+1)
+	}
+
+	close(release)
+	for i := 0; i < 4; i++ {
+		if !<-done {
+			t.Error("Handle() = false for an admitted request")
+		}
+	}
+	// the queues take turns, a flow doesn't get all seats before the others.
+	if want := []string{first, second, first}; !reflect.DeepEqual(executed, want) {
+		t.Errorf("executed %v, want %v", executed, want)
+	}
+}
+
+func TestHandleExempt(t *testing.T) {
+	c := newTestController(t, time.Minute, 0, 0, 0)
+	release, done := make(chan struct{}), make(chan bool, 1)
+	occupy(c, "/a", release, done)
+	defer close(release)
+
+	admin := &user.DefaultInfo{Name: "admin", Groups: []string{user.SystemPrivilegedGroup}}
+	for i := 0; i < 3; i++ {
+		executed := false
+		if !c.Handle(context.Background(), &RequestDigest{User: admin, Path: "/b"}, func() { executed = true }) || !executed {
+			t.Errorf("exempt request %d was not executed", i)
+		}
+	}
+	want := PriorityLevelState{Name: "exempt", Exempt: true, Dispatched: 3}
+	if state := levelState(c, "exempt"); !reflect.DeepEqual(state, want) {
+		t.Errorf("Dump() = %+v, want %+v", state, want)
+	}
+}
+
+func TestHandleUnmatched(t *testing.T) {
+	c := newTestController(t, time.Minute, 0, 0, 0)
+	if c.Handle(context.Background(), &RequestDigest{Path: "api"}, func() { t.Error("the unmatched request was executed") }) {
+		t.Error("Handle() = true for a request no flow schema matches")
+	}
+}
+
+func TestDump(t *testing.T) {
+	c := newTestController(t, time.Minute, 1, 1, 10)
+	states := c.Dump()
+	var names []string
+	for _, state := range states {
+		names = append(names, state.Name)
+	}
+	if want := []string{"exempt", "test"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Dump() returned the levels %v, want them in the configured order %v", names, want)
+	}
+	// idle queues are left out.
+	if len(states[1].Queues) != 0 {
+		t.Errorf("Dump() of an idle level = %+v, want no queues", states[1])
+	}
+}
+
+func TestNew(t *testing.T) {
+	valid := PriorityLevelConfiguration{Name: "test", ConcurrencyShares: 1, Queues: 8, HandSize: 2, QueueLengthLimit: 10}
+	tests := []struct {
+		name                   string
+		serverConcurrencyLimit int
+		queueWaitTimeout       time.Duration
+		levels                 []PriorityLevelConfiguration
+		schemas                []FlowSchema
+		wantErr                bool
+	}{
+		{name: "defaults", levels: DefaultPriorityLevels(), schemas: DefaultFlowSchemas()},
+		{name: "invalid concurrency limit", serverConcurrencyLimit: -1, levels: []PriorityLevelConfiguration{valid}, wantErr: true},
+		{name: "invalid queue wait timeout", queueWaitTimeout: -1, levels: []PriorityLevelConfiguration{valid}, wantErr: true},
+		{name: "unnamed level", levels: []PriorityLevelConfiguration{{ConcurrencyShares: 1}}, wantErr: true},
+		{name: "duplicate level", levels: []PriorityLevelConfiguration{valid, valid}, wantErr: true},
+		{name: "no shares", levels: []PriorityLevelConfiguration{{Name: "test"}}, wantErr: true},
+		{name: "hand larger than queues", levels: []PriorityLevelConfiguration{{Name: "test", ConcurrencyShares: 1, Queues: 2, HandSize: 3, QueueLengthLimit: 1}}, wantErr: true},
+		{name: "no queue length limit", levels: []PriorityLevelConfiguration{{Name: "test", ConcurrencyShares: 1, Queues: 2, HandSize: 1}}, wantErr: true},
+		{name: "unknown level", levels: []PriorityLevelConfiguration{valid}, schemas: []FlowSchema{{Name: "schema", PriorityLevel: "missing"}}, wantErr: true},
+		{name: "duplicate schema", levels: []PriorityLevelConfiguration{valid}, schemas: []FlowSchema{{Name: "schema", PriorityLevel: "test"}, {Name: "schema", PriorityLevel: "test"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConcurrencyLimit, queueWaitTimeout := 10, time.Minute
+			if tt.serverConcurrencyLimit != 0 {
+				serverConcurrencyLimit = tt.serverConcurrencyLimit
+			}
+			if tt.queueWaitTimeout != 0 {
+				queueWaitTimeout = tt.queueWaitTimeout
+			}
+			if _, err := New(serverConcurrencyLimit, queueWaitTimeout, tt.levels, tt.schemas); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package flowcontrol
+
+import "time"
+
+// PriorityLevelState is the state of a priority level returned by Dump.
+type PriorityLevelState struct {
+	Name             string `json:"name"`
+	Exempt           bool   `json:"exempt,omitempty"`
+	ConcurrencyLimit int    `json:"concurrencyLimit,omitempty"`
+	Executing        int    `json:"executing"`
+	Waiting          int    `json:"waiting"`
+	// Dispatched, Rejected and TimedOut count the requests since the start.
+	Dispatched uint64       `json:"dispatched"`
+	Rejected   uint64       `json:"rejected"`
+	TimedOut   uint64       `json:"timedOut"`
+	Queues     []QueueState `json:"queues,omitempty"`
+}
+
+// QueueState is the state of a non-idle queue returned by Dump.
+type QueueState struct {
+	Index     int            `json:"index"`
+	Executing int            `json:"executing"`
+	Waiting   []RequestState `json:"waiting,omitempty"`
+}
+
+// RequestState is a waiting request returned by Dump.
+type RequestState struct {
+	Flow string `json:"flow"`
+	// WaitingFor is how long the request has been waiting, e.g. "1.5s".
+	WaitingFor string `json:"waitingFor"`
+}
+
+// Dump returns the state of all priority levels, for debugging.
+func (c *Controller) Dump() []PriorityLevelState {
+	now := time.Now()
+	states := make([]PriorityLevelState, 0, len(c.levelNames))
+	for _, name := range c.levelNames {
+		states = append(states, c.priorityLevels[name].dump(now))
+	}
+	return states
+}
+
+func (l *priorityLevel) dump(now time.Time) PriorityLevelState {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	state := PriorityLevelState{
+		Name:             l.config.Name,
+		Exempt:           l.config.Exempt,
+		ConcurrencyLimit: l.concurrencyLimit,
+		Executing:        l.executing,
+		Waiting:          l.waitingLocked(),
+		Dispatched:       l.dispatched,
+		Rejected:         l.rejected,
+		TimedOut:         l.timedOut,
+	}
+	for i, q := range l.queues {
+		if q.executing == 0 && len(q.waiting) == 0 {
+			continue
+		}
+		queueState := QueueState{Index: i, Executing: q.executing}
+		for _, req := range q.waiting {
+			queueState.Waiting = append(queueState.Waiting, RequestState{
+				Flow:       req.flow,
+				WaitingFor: now.Sub(req.arrived).Round(time.Millisecond).String(),
+			})
+		}
+		state.Queues = append(state.Queues, queueState)
+	}
+	return state
+}
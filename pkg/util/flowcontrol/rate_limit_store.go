@@ -0,0 +1,72 @@
+package flowcontrol
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitStore holds the token buckets of rate limited keys, e.g. in memory or
+// shared between several servers. Implementations must be safe for concurrent use.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of key. A new bucket is refilled with
+	// qps tokens per second up to burst tokens and starts full.
+	Take(ctx context.Context, key string, qps float64, burst int) (TakeResult, error)
+	// Return puts back a token taken from the bucket of key.
+	Return(ctx context.Context, key string, qps float64, burst int) error
+}
+
+// memoryStoreSweepBatch is the number of buckets the memory store checks on every call,
+// dropping the ones which are full. Sweeping a few buckets at a time keeps the calls cheap
+// no matter how many keys there are, Go's random map iteration order spreads the sweep over
+// all buckets.
+const memoryStoreSweepBatch = 8
+
+var _ RateLimitStore = &memoryRateLimitStore{}
+
+// NewMemoryRateLimitStore returns a RateLimitStore keeping the buckets in memory.
+// Buckets which refilled completely are dropped so that the store doesn't grow
+// with the number of keys ever seen.
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{buckets: map[string]*TokenBucket{}}
+}
+
+type memoryRateLimitStore struct {
+	lock    sync.Mutex
+	buckets map[string]*TokenBucket
+}
+
+func (s *memoryRateLimitStore) Take(ctx context.Context, key string, qps float64, burst int) (TakeResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// the token is taken under the lock so that the bucket isn't dropped in between.
+	return s.bucketLocked(key, qps, burst).TryTake(), nil
+}
+
+func (s *memoryRateLimitStore) Return(ctx context.Context, key string, qps float64, burst int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.bucketLocked(key, qps, burst).Return()
+	return nil
+}
+
+func (s *memoryRateLimitStore) bucketLocked(key string, qps float64, burst int) *TokenBucket {
+	now := time.Now()
+	checked := 0
+	for k, b := range s.buckets {
+		if checked >= memoryStoreSweepBatch {
+			break
+		}
+		checked++
+		if b.full(now) {
+			delete(s.buckets, k)
+		}
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = NewTokenBucket(qps, burst)
+		s.buckets[key] = b
+	}
+	return b
+}
@@ -0,0 +1,60 @@
+package flowcontrol
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	ctx := context.Background()
+
+	for i := 1; i >= 0; i-- {
+		result, err := store.Take(ctx, "a", 0.001, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed || result.Remaining != i {
+			t.Errorf("Take() = %+v, want allowed with %d remaining", result, i)
+		}
+	}
+	if result, _ := store.Take(ctx, "a", 0.001, 2); result.Allowed {
+		t.Errorf("Take() of an empty bucket = %+v, want not allowed", result)
+	}
+	if result, _ := store.Take(ctx, "b", 0.001, 2); !result.Allowed {
+		t.Errorf("Take() of another key = %+v, want allowed", result)
+	}
+
+	if err := store.Return(ctx, "a", 0.001, 2); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := store.Take(ctx, "a", 0.001, 2); !result.Allowed {
+		t.Errorf("Take() after a return = %+v, want allowed", result)
+	}
+}
+
+func TestMemoryRateLimitStoreSweep(t *testing.T) {
+	store := NewMemoryRateLimitStore().(*memoryRateLimitStore)
+	ctx := context.Background()
+
+	// these buckets refill right away.
+	const keys = 10 * memoryStoreSweepBatch
+	for i := 0; i < keys; i++ {
+		store.Take(ctx, fmt.Sprintf("fast-%d", i), 1e12, 1)
+	}
+	store.Take(ctx, "slow", 0.001, 2)
+
+	// every call checks memoryStoreSweepBatch buckets, at most two of which aren't full.
+	for i := 0; i < keys/(memoryStoreSweepBatch-2)+1; i++ {
+		store.Take(ctx, "other", 0.001, 100)
+	}
+	if len(store.buckets) != 2 {
+		t.Errorf("the store holds %d buckets, want only the ones which aren't full", len(store.buckets))
+	}
+
+	// the bucket which isn't full kept its state.
+	if result, _ := store.Take(ctx, "slow", 0.001, 2); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Take() = %+v, want the last token of the bucket", result)
+	}
+}
@@ -0,0 +1,53 @@
+package flowcontrol
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+// maxHashBits is the number of bits of the hash value of a flow dealHand uses.
+const maxHashBits = 60
+
+// validateShuffleSharding checks that hands of handSize cards can be dealt from deckSize
+// cards with maxHashBits of entropy.
+func validateShuffleSharding(deckSize, handSize int) error {
+	if handSize <= 0 || handSize > deckSize {
+		return fmt.Errorf("HandSize %d must be between 1 and the number of queues %d", handSize, deckSize)
+	}
+	if bits := float64(handSize) * math.Log2(float64(deckSize)); bits > maxHashBits {
+		return fmt.Errorf("HandSize %d and %d queues need %.0f bits of entropy, more than %d", handSize, deckSize, bits, maxHashBits)
+	}
+	return nil
+}
+
+// hashFlow returns the hash value the hand of a flow is dealt by.
+func hashFlow(flow string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(flow))
+	return h.Sum64()
+}
+
+// dealHand deals handSize distinct cards out of deckSize cards, using hashValue as the
+// source of randomness. The same hash value is always dealt the same hand.
+func dealHand(hashValue uint64, deckSize, handSize int) []int {
+	hand := make([]int, 0, handSize)
+	dealt := make([]int, 0, handSize)
+	for i := 0; i < handSize; i++ {
+		remaining := uint64(deckSize - i)
+		card := int(hashValue % remaining)
+		hashValue /= remaining
+
+		// card is the index among the cards not dealt yet, skip the dealt ones.
+		for _, d := range dealt {
+			if d <= card {
+				card++
+			}
+		}
+		hand = append(hand, card)
+		dealt = append(dealt, card)
+		sort.Ints(dealt)
+	}
+	return hand
+}
@@ -0,0 +1,83 @@
+package flowcontrol
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestDealHand(t *testing.T) {
+	tests := []struct {
+		deckSize int
+		handSize int
+	}{
+		{deckSize: 1, handSize: 1},
+		{deckSize: 8, handSize: 1},
+		{deckSize: 8, handSize: 8},
+		{deckSize: 128, handSize: 6},
+		{deckSize: 1024, handSize: 6},
+	}
+	hashValues := []uint64{0, 1, 42, 1 << 40, math.MaxUint64, hashFlow("global-default/user/alice")}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d of %d", tt.handSize, tt.deckSize), func(t *testing.T) {
+			for _, hashValue := range hashValues {
+				hand := dealHand(hashValue, tt.deckSize, tt.handSize)
+				if len(hand) != tt.handSize {
+					t.Fatalf("dealHand(%d) dealt %d cards, want %d", hashValue, len(hand), tt.handSize)
+				}
+				dealt := map[int]bool{}
+				for _, card := range hand {
+					if card < 0 || card >= tt.deckSize {
+						t.Errorf("dealHand(%d) = %v, card %d is not in the deck", hashValue, hand, card)
+					}
+					if dealt[card] {
+						t.Errorf("dealHand(%d) = %v, card %d is dealt twice", hashValue, hand, card)
+					}
+					dealt[card] = true
+				}
+				if again := dealHand(hashValue, tt.deckSize, tt.handSize); !reflect.DeepEqual(again, hand) {
+					t.Errorf("dealHand(%d) = %v, then %v, want the same hand", hashValue, hand, again)
+				}
+			}
+		})
+	}
+}
+
+func TestDealHandCoversDeck(t *testing.T) {
+	const deckSize, handSize = 16, 2
+	dealt := map[int]bool{}
+	for i := 0; i < 1000; i++ {
+		for _, card := range dealHand(hashFlow(fmt.Sprintf("flow-%d", i)), deckSize, handSize) {
+			dealt[card] = true
+		}
+	}
+	if len(dealt) != deckSize {
+		t.Errorf("%d of %d cards were dealt to 1000 flows, want all of them", len(dealt), deckSize)
+	}
+}
+
+func TestValidateShuffleSharding(t *testing.T) {
+	tests := []struct {
+		deckSize int
+		handSize int
+		wantErr  bool
+	}{
+		{deckSize: 128, handSize: 6},
+		{deckSize: 1, handSize: 1},
+		{deckSize: 8, handSize: 0, wantErr: true},
+		{deckSize: 8, handSize: 9, wantErr: true},
+		// 3 * 20 and 4 * 15 bits are just enough.
+		{deckSize: 1 << 20, handSize: 3},
+		{deckSize: 1 << 20, handSize: 4, wantErr: true},
+		{deckSize: 1 << 15, handSize: 4},
+		{deckSize: 1 << 15, handSize: 5, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d of %d", tt.handSize, tt.deckSize), func(t *testing.T) {
+			if err := validateShuffleSharding(tt.deckSize, tt.handSize); (err != nil) != tt.wantErr {
+				t.Errorf("validateShuffleSharding() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+// Package flowcontrol provides rate limiters.
+package flowcontrol
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket is a token bucket rate limiter. It is refilled with qps tokens
+// per second up to burst tokens and starts full.
+type TokenBucket struct {
+	qps   float64
+	burst float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// TakeResult is the outcome of taking a token from a TokenBucket.
+type TakeResult struct {
+	// Allowed is whether a token was taken.
+	Allowed bool
+	// Limit is the burst of the bucket.
+	Limit int
+	// Remaining is the number of whole tokens left.
+	Remaining int
+	// RetryAfter is how long it takes until the next token is available.
+	RetryAfter time.Duration
+	// Reset is how long it takes until the bucket is full again.
+	Reset time.Duration
+}
+
+// NewTokenBucket returns a TokenBucket which allows qps events per second on
+// average and bursts of up to burst events. burst is at least 1.
+func NewTokenBucket(qps float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		qps:    qps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// TryAccept takes a token if one is available and returns whether it did.
+func (b *TokenBucket) TryAccept() bool {
+	return b.TryTake().Allowed
+}
+
+// TryTake takes a token if one is available.
+func (b *TokenBucket) TryTake() TakeResult {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(time.Now())
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	result := TakeResult{
+		Allowed:   allowed,
+		Limit:     int(b.burst),
+		Remaining: int(math.Floor(b.tokens)),
+		Reset:     b.durationFor(b.burst - b.tokens),
+	}
+	if b.tokens < 1 {
+		result.RetryAfter = b.durationFor(1 - b.tokens)
+	}
+	return result
+}
+
+// Return puts back a token taken by TryTake, e.g. because the event it was taken
+// for didn't happen after all. The bucket never exceeds its burst.
+func (b *TokenBucket) Return() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(time.Now())
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// full returns whether the bucket is full at now.
+func (b *TokenBucket) full(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// refill adds the tokens accumulated since the last refill.
+func (b *TokenBucket) refill(now time.Time) {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.qps
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+}
+
+// durationFor returns how long it takes to refill the given number of tokens.
+func (b *TokenBucket) durationFor(tokens float64) time.Duration {
+	if tokens <= 0 || b.qps <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / b.qps * float64(time.Second))
+}
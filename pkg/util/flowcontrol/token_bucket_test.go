@@ -0,0 +1,89 @@
+package flowcontrol
+
+import (
+	"testing"
+	"time"
+)
+
+// elapse pretends that d passed since the last refill of b.
+func elapse(b *TokenBucket, d time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.last = b.last.Add(-d)
+}
+
+func TestTokenBucket(t *testing.T) {
+	b := NewTokenBucket(2, 3)
+
+	for i := 2; i >= 0; i-- {
+		result := b.TryTake()
+		if !result.Allowed || result.Limit != 3 || result.Remaining != i {
+			t.Errorf("TryTake() = %+v, want allowed with %d remaining of 3", result, i)
+		}
+	}
+	result := b.TryTake()
+	if result.Allowed || result.Remaining != 0 {
+		t.Errorf("TryTake() of an empty bucket = %+v, want not allowed", result)
+	}
+	// a token every 500ms, 1.5s until all 3 are back.
+	if result.RetryAfter < 499*time.Millisecond || result.RetryAfter > 500*time.Millisecond {
+		t.Errorf("RetryAfter = %v, want 500ms", result.RetryAfter)
+	}
+	if result.Reset < 1499*time.Millisecond || result.Reset > 1500*time.Millisecond {
+		t.Errorf("Reset = %v, want 1.5s", result.Reset)
+	}
+
+	elapse(b, time.Second)
+	for i := 1; i >= 0; i-- {
+		if result := b.TryTake(); !result.Allowed || result.Remaining != i {
+			t.Errorf("TryTake() after a second = %+v, want allowed with %d remaining", result, i)
+		}
+	}
+	if b.TryAccept() {
+		t.Error("TryAccept() = true after the refilled tokens were taken")
+	}
+
+	// the bucket doesn't refill beyond its burst.
+	elapse(b, time.Hour)
+	if !b.full(time.Now()) {
+		t.Error("the bucket isn't full after an hour")
+	}
+	for i := 0; i < 3; i++ {
+		b.TryAccept()
+	}
+	if b.TryAccept() {
+		t.Error("TryAccept() = true beyond the burst")
+	}
+}
+
+func TestTokenBucketReturn(t *testing.T) {
+	b := NewTokenBucket(0.001, 2)
+
+	b.TryAccept()
+	b.TryAccept()
+	b.Return()
+	if result := b.TryTake(); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("TryTake() after a return = %+v, want the returned token", result)
+	}
+
+	// returned tokens don't exceed the burst.
+	for i := 0; i < 5; i++ {
+		b.Return()
+	}
+	if !b.full(time.Now()) {
+		t.Error("the bucket isn't full after returning its tokens")
+	}
+	if result := b.TryTake(); result.Remaining != 1 {
+		t.Errorf("TryTake() after returning more than the burst = %+v, want 1 remaining", result)
+	}
+}
+
+func TestTokenBucketMinimumBurst(t *testing.T) {
+	b := NewTokenBucket(0.001, 0)
+	if !b.TryAccept() {
+		t.Error("TryAccept() = false, want a burst of at least 1")
+	}
+	if b.TryAccept() {
+		t.Error("TryAccept() = true, want a burst of 1")
+	}
+}
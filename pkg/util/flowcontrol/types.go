@@ -0,0 +1,158 @@
+package flowcontrol
+
+import (
+	"strings"
+
+	"github.com/ForbiddenR/apiserver/pkg/authentication/user"
+)
+
+// RequestDigest holds the attributes of a request its flow schema and flow are
+// determined by.
+type RequestDigest struct {
+	// User is the authenticated user, nil for anonymous requests.
+	User     user.Info
+	Method   string
+	Path     string
+	ClientIP string
+	// Header returns the value of the request header named name.
+	Header func(name string) string
+}
+
+// PriorityLevelConfiguration configures how many requests of a priority level
+// are served concurrently and how the others are queued.
+type PriorityLevelConfiguration struct {
+	Name string
+	// Exempt priority levels are not limited at all.
+	Exempt bool
+	// ConcurrencyShares is the share of the server concurrency limit the priority
+	// level gets, relative to the shares of the other non-exempt priority levels.
+	ConcurrencyShares int
+	// Queues is the number of queues of the priority level. If zero, requests
+	// are rejected instead of queued once the concurrency limit is reached.
+	Queues int
+	// HandSize is the number of queues a flow is shuffle-sharded to. A request is
+	// queued to the shortest queue of the hand of its flow.
+	HandSize int
+	// QueueLengthLimit is the maximum number of requests waiting in a queue.
+	QueueLengthLimit int
+}
+
+// FlowSchema classifies requests into a priority level and a flow within it.
+type FlowSchema struct {
+	Name string
+	// PriorityLevel is the name of the priority level of the matching requests.
+	PriorityLevel string
+	// MatchingPrecedence orders the flow schemas, a request belongs to the first one
+	// matching it. Lower numbers come first.
+	MatchingPrecedence int
+	// Matches returns whether the request belongs to the flow schema. nil matches all requests.
+	Matches func(r *RequestDigest) bool
+	// FlowDistinguisher returns the flow of the request within the flow schema.
+	// nil puts all matching requests into the same flow.
+	FlowDistinguisher func(r *RequestDigest) string
+}
+
+// MatchUsers matches requests of the users with one of the given names.
+func MatchUsers(names ...string) func(r *RequestDigest) bool {
+	return func(r *RequestDigest) bool {
+		if r.User == nil {
+			return false
+		}
+		for _, name := range names {
+			if r.User.GetName() == name {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchGroups matches requests of users in one of the given groups.
+func MatchGroups(groups ...string) func(r *RequestDigest) bool {
+	return func(r *RequestDigest) bool {
+		if r.User == nil {
+			return false
+		}
+		for _, userGroup := range r.User.GetGroups() {
+			for _, group := range groups {
+				if userGroup == group {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// MatchPathPrefixes matches requests whose path starts with one of the given prefixes.
+func MatchPathPrefixes(prefixes ...string) func(r *RequestDigest) bool {
+	return func(r *RequestDigest) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FlowByUser distinguishes flows by the name of the user. Anonymous requests are
+// distinguished by their client IP.
+func FlowByUser(r *RequestDigest) string {
+	if r.User == nil {
+		return "anonymous/" + r.ClientIP
+	}
+	return "user/" + r.User.GetName()
+}
+
+// FlowByRoute distinguishes flows by the path of the request.
+func FlowByRoute(r *RequestDigest) string {
+	return r.Path
+}
+
+// FlowByHeader distinguishes flows by the value of the request header named name,
+// e.g. a tenant header.
+func FlowByHeader(name string) func(r *RequestDigest) string {
+	return func(r *RequestDigest) string {
+		if r.Header == nil {
+			return ""
+		}
+		return r.Header(name)
+	}
+}
+
+// DefaultPriorityLevels returns the priority levels of DefaultFlowSchemas.
+func DefaultPriorityLevels() []PriorityLevelConfiguration {
+	return []PriorityLevelConfiguration{
+		{
+			Name:   "exempt",
+			Exempt: true,
+		},
+		{
+			Name:              "global-default",
+			ConcurrencyShares: 20,
+			Queues:            128,
+			HandSize:          6,
+			QueueLengthLimit:  50,
+		},
+	}
+}
+
+// DefaultFlowSchemas exempts the system:masters group and queues all other
+// requests fairly by user.
+func DefaultFlowSchemas() []FlowSchema {
+	return []FlowSchema{
+		{
+			Name:               "exempt",
+			PriorityLevel:      "exempt",
+			MatchingPrecedence: 1,
+			Matches:            MatchGroups(user.SystemPrivilegedGroup),
+		},
+		{
+			Name:               "global-default",
+			PriorityLevel:      "global-default",
+			MatchingPrecedence: 9900,
+			FlowDistinguisher:  FlowByUser,
+		},
+	}
+}
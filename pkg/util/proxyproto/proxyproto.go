@@ -0,0 +1,323 @@
+// Package proxyproto reads the PROXY protocol v1 and v2 header which proxies
+// in front of the server send to pass on the address of the client, see
+// https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode determines whether trusted sources must send the header.
+type Mode string
+
+const (
+	// ModeOptional serves connections without the header with their own remote address.
+	ModeOptional Mode = "optional"
+	// ModeStrict closes connections from trusted sources which don't send the header.
+	ModeStrict Mode = "strict"
+)
+
+const (
+	// defaultHeaderTimeout bounds reading the header if Options.HeaderTimeout is zero.
+	defaultHeaderTimeout = 10 * time.Second
+	// maxV1HeaderLength is the maximum length of a v1 header including the CRLF.
+	maxV1HeaderLength = 107
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// Options configures which connections the header is read from.
+type Options struct {
+	Mode Mode
+	// TrustedCIDRs are the addresses of the proxies. The header is only read from connections
+	// of these addresses, the others are served with their own remote address. No source is
+	// trusted if empty, as any client could pass itself off as any address otherwise.
+	TrustedCIDRs []*net.IPNet
+	// HeaderTimeout bounds reading the header. Zero means 10 seconds.
+	HeaderTimeout time.Duration
+}
+
+// ParseMode returns the Mode named name.
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(name); mode {
+	case ModeOptional, ModeStrict:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown PROXY protocol mode %q, must be one of %q or %q", name, ModeOptional, ModeStrict)
+}
+
+// ParseCIDRs parses the trusted source CIDRs, e.g. "10.0.0.0/8".
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, ipNet)
+	}
+	return result, nil
+}
+
+// NewListener wraps ln so that the remote address of the accepted connections is the source
+// address of their PROXY protocol header. The header is read lazily on the first Read or
+// RemoteAddr call so that slow clients don't block accepting other connections.
+func NewListener(ln net.Listener, options Options) net.Listener {
+	if options.HeaderTimeout == 0 {
+		options.HeaderTimeout = defaultHeaderTimeout
+	}
+	return &listener{Listener: ln, options: options}
+}
+
+type listener struct {
+	net.Listener
+	options Options
+}
+
+func (ln *listener) Accept() (net.Conn, error) {
+	c, err := ln.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if !ln.trusted(c.RemoteAddr()) {
+		return c, nil
+	}
+	return &Conn{Conn: c, options: ln.options, reader: bufio.NewReader(c)}, nil
+}
+
+func (ln *listener) trusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, cidr := range ln.options.TrustedCIDRs {
+		if cidr.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection of a trusted source.
+type Conn struct {
+	net.Conn
+	options Options
+	reader  *bufio.Reader
+
+	once       sync.Once
+	headerErr  error
+	remoteAddr net.Addr
+	localAddr  net.Addr
+
+	// readDeadline is the read deadline last set by the user of the connection,
+	// it is restored once the header has been read.
+	deadlineLock sync.Mutex
+	readDeadline time.Time
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.headerErr != nil {
+		return 0, c.headerErr
+	}
+	return c.reader.Read(b)
+}
+
+// RemoteAddr returns the source address of the header, or the remote address of
+// the connection if there is none.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address of the header, or the local address of
+// the connection if there is none.
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// SetDeadline sets the read and write deadlines, the read deadline is restored
+// once the header has been read.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline, it is restored once the header has been read.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.deadlineLock.Lock()
+	defer c.deadlineLock.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *Conn) readHeader() {
+	c.deadlineLock.Lock()
+	headerDeadline := time.Now().Add(c.options.HeaderTimeout)
+	if !c.readDeadline.IsZero() && c.readDeadline.Before(headerDeadline) {
+		headerDeadline = c.readDeadline
+	}
+	c.Conn.SetReadDeadline(headerDeadline)
+	c.deadlineLock.Unlock()
+	defer func() {
+		c.deadlineLock.Lock()
+		defer c.deadlineLock.Unlock()
+		c.Conn.SetReadDeadline(c.readDeadline)
+	}()
+
+	var err error
+	c.remoteAddr, c.localAddr, err = readHeader(c.reader, c.options.Mode == ModeStrict)
+	if err != nil {
+		c.headerErr = fmt.Errorf("invalid PROXY protocol header from %s: %v", c.Conn.RemoteAddr(), err)
+		c.Conn.Close()
+	}
+}
+
+// readHeader reads the header if there is one. The addresses are nil if the header
+// doesn't carry them, e.g. for health checks of the proxy.
+func readHeader(r *bufio.Reader, required bool) (net.Addr, net.Addr, error) {
+	// peek byte by byte as a client without header might send less than the signature and wait.
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case first[0] == v1Prefix[0] && hasPrefix(r, v1Prefix):
+		return readV1Header(r)
+	case first[0] == v2Signature[0] && hasPrefix(r, v2Signature):
+		return readV2Header(r)
+	case required:
+		return nil, nil, fmt.Errorf("missing header")
+	}
+	return nil, nil, nil
+}
+
+func hasPrefix(r *bufio.Reader, prefix []byte) bool {
+	for i := 1; i <= len(prefix); i++ {
+		peeked, err := r.Peek(i)
+		if err != nil || peeked[i-1] != prefix[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// readV1Header reads e.g. "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n".
+func readV1Header(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= maxV1HeaderLength {
+			return nil, nil, fmt.Errorf("v1 header longer than %d bytes", maxV1HeaderLength)
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("malformed v1 header %q", strings.TrimSpace(string(line)))
+	}
+	src, err := parseV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func parseV1Addr(ip, port string) (*net.TCPAddr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil {
+		return nil, fmt.Errorf("invalid address %q in v1 header", ip)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q in v1 header", port)
+	}
+	addr.Port = int(p)
+	return addr, nil
+}
+
+// readV2Header reads the binary header, its TLVs are skipped.
+func readV2Header(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	if version := header[12] >> 4; version != 2 {
+		return nil, nil, fmt.Errorf("unsupported version %d", version)
+	}
+	command, family := header[12]&0x0f, header[13]
+	payload := make([]byte, binary.BigEndian.Uint16(header[14:16]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	switch command {
+	case 0x0:
+		// LOCAL, e.g. a health check of the proxy itself.
+		return nil, nil, nil
+	case 0x1:
+		// PROXY
+	default:
+		return nil, nil, fmt.Errorf("unsupported command %d", command)
+	}
+
+	var ipLength int
+	switch family {
+	case 0x11, 0x12:
+		ipLength = net.IPv4len
+	case 0x21, 0x22:
+		ipLength = net.IPv6len
+	default:
+		// UNSPEC and unix sockets carry no address the client could be identified by.
+		return nil, nil, nil
+	}
+	if len(payload) < 2*ipLength+4 {
+		return nil, nil, fmt.Errorf("v2 header of %d bytes too short for its addresses", len(payload))
+	}
+	src := &net.TCPAddr{
+		IP:   net.IP(append([]byte{}, payload[:ipLength]...)),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLength:])),
+	}
+	dst := &net.TCPAddr{
+		IP:   net.IP(append([]byte{}, payload[ipLength:2*ipLength]...)),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLength+2:])),
+	}
+	return src, dst, nil
+}
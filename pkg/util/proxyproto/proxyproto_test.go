@@ -0,0 +1,382 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// v2Header returns a v2 header with the given version and command byte, family and payload.
+func v2Header(versionCommand, family byte, payload []byte) string {
+	header := append([]byte{}, v2Signature...)
+	header = append(header, versionCommand, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(payload)))
+	return string(append(header, payload...))
+}
+
+// v2Addresses returns the payload of the addresses src:srcPort and dst:dstPort.
+func v2Addresses(src, dst net.IP, srcPort, dstPort uint16) []byte {
+	payload := append(append([]byte{}, src...), dst...)
+	payload = binary.BigEndian.AppendUint16(payload, srcPort)
+	return binary.BigEndian.AppendUint16(payload, dstPort)
+}
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		required bool
+		// wantSrc and wantDst are the addresses of the header, empty if there are none.
+		wantSrc  string
+		wantDst  string
+		wantErr  bool
+		wantRest string
+	}{
+		{
+			name:     "v1 TCP4",
+			input:    "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\nGET /",
+			wantSrc:  "192.0.2.1:56324",
+			wantDst:  "192.0.2.2:443",
+			wantRest: "GET /",
+		},
+		{
+			name:     "v1 TCP6",
+			input:    "PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\nGET /",
+			wantSrc:  "[2001:db8::1]:56324",
+			wantDst:  "[2001:db8::2]:443",
+			wantRest: "GET /",
+		},
+		{
+			name:     "v1 UNKNOWN",
+			input:    "PROXY UNKNOWN\r\nGET /",
+			wantRest: "GET /",
+		},
+		{
+			name:    "v1 too long",
+			input:   "PROXY TCP4 " + strings.Repeat("1", maxV1HeaderLength) + "\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "v1 without CRLF",
+			input:   "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443",
+			wantErr: true,
+		},
+		{
+			name:    "v1 missing fields",
+			input:   "PROXY TCP4 192.0.2.1 192.0.2.2\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "v1 unknown protocol",
+			input:   "PROXY UDP4 192.0.2.1 192.0.2.2 56324 443\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "v1 invalid address",
+			input:   "PROXY TCP4 192.0.2 192.0.2.2 56324 443\r\n",
+			wantErr: true,
+		},
+		{
+			name:    "v1 invalid port",
+			input:   "PROXY TCP4 192.0.2.1 192.0.2.2 65536 443\r\n",
+			wantErr: true,
+		},
+		{
+			name:     "v2 LOCAL",
+			input:    v2Header(0x20, 0x00, nil) + "GET /",
+			required: true,
+			wantRest: "GET /",
+		},
+		{
+			name:     "v2 PROXY IPv4",
+			input:    v2Header(0x21, 0x11, v2Addresses(net.IPv4(192, 0, 2, 1).To4(), net.IPv4(192, 0, 2, 2).To4(), 56324, 443)) + "GET /",
+			wantSrc:  "192.0.2.1:56324",
+			wantDst:  "192.0.2.2:443",
+			wantRest: "GET /",
+		},
+		{
+			name:     "v2 PROXY IPv6",
+			input:    v2Header(0x21, 0x21, v2Addresses(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2"), 56324, 443)) + "GET /",
+			wantSrc:  "[2001:db8::1]:56324",
+			wantDst:  "[2001:db8::2]:443",
+			wantRest: "GET /",
+		},
+		{
+			name:     "v2 PROXY with TLVs",
+			input:    v2Header(0x21, 0x11, append(v2Addresses(net.IPv4(192, 0, 2, 1).To4(), net.IPv4(192, 0, 2, 2).To4(), 56324, 443), 0x04, 0, 1, 'x')) + "GET /",
+			wantSrc:  "192.0.2.1:56324",
+			wantDst:  "192.0.2.2:443",
+			wantRest: "GET /",
+		},
+		{
+			name:     "v2 unix family",
+			input:    v2Header(0x21, 0x31, make([]byte, 216)) + "GET /",
+			wantRest: "GET /",
+		},
+		{
+			name:    "v2 addresses too short",
+			input:   v2Header(0x21, 0x11, make([]byte, 8)),
+			wantErr: true,
+		},
+		{
+			name:    "v2 unsupported version",
+			input:   v2Header(0x11, 0x11, v2Addresses(net.IPv4(192, 0, 2, 1).To4(), net.IPv4(192, 0, 2, 2).To4(), 56324, 443)),
+			wantErr: true,
+		},
+		{
+			name:    "v2 unsupported command",
+			input:   v2Header(0x22, 0x11, v2Addresses(net.IPv4(192, 0, 2, 1).To4(), net.IPv4(192, 0, 2, 2).To4(), 56324, 443)),
+			wantErr: true,
+		},
+		{
+			name:    "v2 truncated header",
+			input:   string(v2Signature) + "\x21\x11",
+			wantErr: true,
+		},
+		{
+			name:    "v2 truncated payload",
+			input:   v2Header(0x21, 0x11, make([]byte, 12))[:20],
+			wantErr: true,
+		},
+		{
+			name:     "no header optional",
+			input:    "GET /",
+			wantRest: "GET /",
+		},
+		{
+			name:     "partial signature optional",
+			input:    "PROX",
+			wantRest: "PROX",
+		},
+		{
+			name:     "no header strict",
+			input:    "GET /",
+			required: true,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bufio.NewReader(strings.NewReader(tt.input))
+			src, dst, err := readHeader(r, tt.required)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := addrString(src); got != tt.wantSrc {
+				t.Errorf("source = %q, want %q", got, tt.wantSrc)
+			}
+			if got := addrString(dst); got != tt.wantDst {
+				t.Errorf("destination = %q, want %q", got, tt.wantDst)
+			}
+			rest, _ := io.ReadAll(r)
+			if string(rest) != tt.wantRest {
+				t.Errorf("rest = %q, want %q", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func addrString(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// accept sends data on a new connection to ln and returns the accepted connection and
+// the address of the client. The client connection is closed after closeAfter.
+func accept(t *testing.T, ln net.Listener, data string, closeAfter time.Duration) (net.Conn, string) {
+	t.Helper()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	timer := time.AfterFunc(closeAfter, func() { client.Close() })
+	t.Cleanup(func() {
+		timer.Stop()
+		client.Close()
+	})
+
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, client.LocalAddr().String()
+}
+
+func listen(t *testing.T, options Options) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	return NewListener(ln, options)
+}
+
+func TestListener(t *testing.T) {
+	const header = "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n"
+	localhost := mustParseCIDRs(t, "127.0.0.0/8")
+	other := mustParseCIDRs(t, "10.0.0.0/8")
+
+	tests := []struct {
+		name    string
+		options Options
+		data    string
+		// wantRemote is the remote address of the connection, empty for the one of the client.
+		wantRemote string
+		wantRead   string
+		wantErr    bool
+	}{
+		{
+			name:       "trusted strict with header",
+			options:    Options{Mode: ModeStrict, TrustedCIDRs: localhost},
+			data:       header + "GET /",
+			wantRemote: "192.0.2.1:56324",
+			wantRead:   "GET /",
+		},
+		{
+			name:    "trusted strict without header",
+			options: Options{Mode: ModeStrict, TrustedCIDRs: localhost},
+			data:    "GET /",
+			wantErr: true,
+		},
+		{
+			name:       "trusted optional with header",
+			options:    Options{Mode: ModeOptional, TrustedCIDRs: localhost},
+			data:       header + "GET /",
+			wantRemote: "192.0.2.1:56324",
+			wantRead:   "GET /",
+		},
+		{
+			name:     "trusted optional without header",
+			options:  Options{Mode: ModeOptional, TrustedCIDRs: localhost},
+			data:     "GET /",
+			wantRead: "GET /",
+		},
+		{
+			name:     "untrusted",
+			options:  Options{Mode: ModeStrict, TrustedCIDRs: other},
+			data:     header + "GET /",
+			wantRead: header + "GET /",
+		},
+		{
+			name:     "no trusted sources",
+			options:  Options{Mode: ModeOptional},
+			data:     header + "GET /",
+			wantRead: header + "GET /",
+		},
+		{
+			name:    "invalid header",
+			options: Options{Mode: ModeOptional, TrustedCIDRs: localhost},
+			data:    "PROXY TCP4 invalid\r\nGET /",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln := listen(t, tt.options)
+			conn, clientAddr := accept(t, ln, tt.data, time.Second)
+
+			buf := make([]byte, len(tt.data))
+			n, err := io.ReadAtLeast(conn, buf, max(len(tt.wantRead), 1))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if got := string(buf[:n]); got != tt.wantRead {
+				t.Errorf("Read() = %q, want %q", got, tt.wantRead)
+			}
+			wantRemote := tt.wantRemote
+			if len(wantRemote) == 0 {
+				wantRemote = clientAddr
+			}
+			if got := conn.RemoteAddr().String(); got != wantRemote {
+				t.Errorf("RemoteAddr() = %q, want %q", got, wantRemote)
+			}
+		})
+	}
+}
+
+func TestHeaderTimeout(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	ln := listen(t, Options{Mode: ModeStrict, TrustedCIDRs: mustParseCIDRs(t, "127.0.0.0/8"), HeaderTimeout: timeout})
+	// a client which sends part of the header only.
+	conn, _ := accept(t, ln, "PROXY TCP4", time.Second)
+
+	start := time.Now()
+	_, err := conn.Read(make([]byte, 1))
+	if err == nil || !strings.Contains(err.Error(), "i/o timeout") {
+		t.Errorf("Read() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < timeout || elapsed > 10*timeout {
+		t.Errorf("Read() returned after %v, want after %v", elapsed, timeout)
+	}
+}
+
+func TestReadDeadlineRestored(t *testing.T) {
+	const deadline = 100 * time.Millisecond
+	ln := listen(t, Options{Mode: ModeStrict, TrustedCIDRs: mustParseCIDRs(t, "127.0.0.0/8"), HeaderTimeout: time.Minute})
+	// the client closes the connection after a second, reads without a deadline return io.EOF then.
+	conn, _ := accept(t, ln, "PROXY TCP4 192.0.2.1 192.0.2.2 56324 443\r\n", time.Second)
+
+	if err := conn.SetReadDeadline(time.Now().Add(deadline)); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err := conn.Read(make([]byte, 1))
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Errorf("Read() error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < deadline/2 || elapsed > 5*deadline {
+		t.Errorf("Read() returned after %v, want after %v", elapsed, deadline)
+	}
+}
+
+func mustParseCIDRs(t *testing.T, cidrs ...string) []*net.IPNet {
+	t.Helper()
+	result, err := ParseCIDRs(cidrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Mode
+		wantErr bool
+	}{
+		{name: "optional", want: ModeOptional},
+		{name: "strict", want: ModeStrict},
+		{name: "", wantErr: true},
+		{name: "always", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMode(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}